@@ -0,0 +1,265 @@
+//go:build ignore
+
+// Generates synthetic-*.jpg, procedurally drawn front-facing portraits in
+// different skin tones, so style previews work out of the box without
+// shipping photos of real people. Run from this directory with:
+//
+//	go run generate.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+)
+
+const (
+	width  = 480
+	height = 600
+)
+
+// rgb is a colour with float channels in 0-255
+type rgb struct{ r, g, b float64 }
+
+func (c rgb) scale(f float64) rgb { return rgb{c.r * f, c.g * f, c.b * f} }
+
+func mix(a, b rgb, t float64) rgb {
+	return rgb{a.r + (b.r-a.r)*t, a.g + (b.g-a.g)*t, a.b + (b.b-a.b)*t}
+}
+
+type canvas [height][width]rgb
+
+// portrait is the colouring of one generated face
+type portrait struct {
+	file             string
+	skin, hair, lips rgb
+	seed             int64
+}
+
+var portraits = []portrait{
+	{"synthetic-01.jpg", rgb{208, 162, 132}, rgb{48, 34, 26}, rgb{168, 92, 88}, 1},
+	{"synthetic-02.jpg", rgb{150, 102, 74}, rgb{22, 18, 16}, rgb{104, 56, 52}, 2},
+}
+
+// ellipse is 1 inside the ellipse, 0 outside, with a soft edge of about
+// feather pixels
+func ellipse(x, y, cx, cy, rx, ry, feather float64) float64 {
+	d := math.Hypot((x-cx)/rx, (y-cy)/ry)
+	edge := feather / math.Min(rx, ry)
+	return smoothstep(1+edge, 1-edge, d)
+}
+
+func smoothstep(edge0, edge1, v float64) float64 {
+	t := math.Max(0, math.Min(1, (v-edge0)/(edge1-edge0)))
+	return t * t * (3 - 2*t)
+}
+
+// paint blends c over the canvas wherever alpha(x, y) is positive
+func (cv *canvas) paint(alpha func(x, y float64) float64, c func(x, y float64) rgb) {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			if a := alpha(fx, fy); a > 0 {
+				cv[y][x] = mix(cv[y][x], c(fx, fy), math.Min(1, a))
+			}
+		}
+	}
+}
+
+// shade multiplies the canvas by 1 - amount*alpha
+func (cv *canvas) shade(alpha func(x, y float64) float64, amount float64) {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			if a := alpha(fx, fy); a > 0 {
+				cv[y][x] = cv[y][x].scale(1 - amount*math.Min(1, a))
+			}
+		}
+	}
+}
+
+func solid(c rgb) func(x, y float64) rgb { return func(x, y float64) rgb { return c } }
+
+func main() {
+	for _, p := range portraits {
+		if err := save(p.file, draw(p)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func draw(p portrait) *image.RGBA {
+	cv := new(canvas)
+	skin, hair, lips := p.skin, p.hair, p.lips
+	cx, cy := 240.0, 300.0 // face centre
+
+	// Backdrop: soft studio gradient
+	cv.paint(func(x, y float64) float64 { return 1 }, func(x, y float64) rgb {
+		return mix(rgb{214, 218, 222}, rgb{176, 182, 190}, y/height)
+	})
+
+	// Hair behind the head
+	cv.paint(func(x, y float64) float64 {
+		return ellipse(x, y, cx, cy-40, 150, 190, 6) * smoothstep(470, 430, y)
+	}, solid(hair))
+
+	// Neck and shoulders
+	cv.paint(func(x, y float64) float64 {
+		return smoothstep(58, 52, math.Abs(x-cx)) * smoothstep(380, 400, y)
+	}, func(x, y float64) rgb {
+		return skin.scale(0.8 - 0.12*math.Abs(x-cx)/58)
+	})
+	cv.paint(func(x, y float64) float64 { return ellipse(x, y, cx, 700, 270, 180, 3) }, func(x, y float64) rgb {
+		return rgb{62, 84, 112}.scale(1 - 0.15*math.Abs(x-cx)/270)
+	})
+	// Shadow under the jaw
+	cv.shade(func(x, y float64) float64 { return ellipse(x, y, cx, 455, 70, 28, 14) }, 0.3)
+
+	// Ears
+	for _, side := range []float64{-1, 1} {
+		ex := cx + side*122
+		cv.paint(func(x, y float64) float64 { return ellipse(x, y, ex, 300, 16, 32, 2) }, solid(skin.scale(0.85)))
+	}
+
+	// Face, lit from the front: darker towards the edges and the jaw
+	cv.paint(func(x, y float64) float64 {
+		// Narrow the lower half towards the chin
+		rx := 122.0
+		if y > cy {
+			rx -= 38 * math.Pow(math.Min(1, (y-cy)/160), 2)
+		}
+		return ellipse(x, y, cx, cy, rx, 160, 2)
+	}, func(x, y float64) rgb {
+		d := math.Hypot((x-cx)/122, (y-cy+20)/160)
+		return skin.scale(1.05 - 0.28*d*d)
+	})
+
+	// Light catches the forehead and the cheekbones
+	highlight := func(x, y float64) rgb { return mix(skin, rgb{255, 236, 220}, 0.3) }
+	cv.paint(func(x, y float64) float64 { return ellipse(x, y, cx, cy-85, 60, 30, 30) * 0.6 }, highlight)
+	for _, side := range []float64{-1, 1} {
+		hx := cx + side*55
+		cv.paint(func(x, y float64) float64 { return ellipse(x, y, hx, cy+30, 30, 22, 22) * 0.5 }, highlight)
+	}
+
+	// Fringe and hairline over the forehead
+	cv.paint(func(x, y float64) float64 {
+		return ellipse(x, y, cx, cy-150, 135, 70, 8) + ellipse(x, y, cx-70, cy-115, 55, 45, 10)*0.9
+	}, solid(hair))
+	// Hair framing the temples
+	for _, side := range []float64{-1, 1} {
+		hx := cx + side*128
+		cv.paint(func(x, y float64) float64 { return ellipse(x, y, hx, cy-40, 22, 110, 8) }, solid(hair))
+	}
+
+	eyeY := cy - 15
+	for _, side := range []float64{-1, 1} {
+		ex := cx + side*50
+
+		// Eye sockets are shadowed below the brow ridge
+		cv.shade(func(x, y float64) float64 { return ellipse(x, y, ex, eyeY-4, 38, 24, 14) }, 0.22)
+
+		// Brows
+		cv.paint(func(x, y float64) float64 {
+			t := (x - ex) * side / 40 // 0 at the inner end, 1 at the outer
+			centre := eyeY - 32 - 6*math.Sin(math.Pi*math.Max(0, math.Min(1, (t+1)/2)))
+			thickness := 6 - 2*t
+			return smoothstep(thickness+1.5, thickness-1.5, math.Abs(y-centre)) * smoothstep(42, 36, math.Abs(x-ex))
+		}, solid(hair.scale(1.1)))
+
+		// Whites, iris, pupil and catch light
+		cv.paint(func(x, y float64) float64 {
+			if math.Abs(x-ex) >= 22 {
+				return 0
+			}
+			upper := eyeY - 10*math.Sqrt(1-math.Pow((x-ex)/22, 2))
+			lower := eyeY + 7*math.Sqrt(1-math.Pow((x-ex)/22, 2))
+			return smoothstep(upper-1, upper+1, y) * smoothstep(lower+1, lower-1, y)
+		}, solid(rgb{232, 226, 220}))
+		cv.paint(func(x, y float64) float64 {
+			upper := eyeY - 10*math.Sqrt(math.Max(0, 1-math.Pow((x-ex)/22, 2)))
+			return ellipse(x, y, ex, eyeY-1, 9, 9, 1) * smoothstep(upper-1, upper+1, y)
+		}, solid(rgb{92, 62, 40}))
+		cv.paint(func(x, y float64) float64 { return ellipse(x, y, ex, eyeY-1, 4, 4, 1) }, solid(rgb{20, 14, 12}))
+		cv.paint(func(x, y float64) float64 { return ellipse(x, y, ex+3, eyeY-4, 1.6, 1.6, 0.8) }, solid(rgb{250, 250, 250}))
+
+		// Upper lid line and lashes
+		cv.paint(func(x, y float64) float64 {
+			upper := eyeY - 10*math.Sqrt(math.Max(0, 1-math.Pow((x-ex)/23, 2)))
+			return smoothstep(2.5, 1, math.Abs(y-upper)) * smoothstep(24, 21, math.Abs(x-ex))
+		}, solid(rgb{40, 28, 24}))
+	}
+
+	// Nose: shaded sides, a lit bridge, and nostrils
+	for _, side := range []float64{-1, 1} {
+		nx := cx + side*16
+		cv.shade(func(x, y float64) float64 { return ellipse(x, y, nx, cy+15, 7, 42, 8) }, 0.12)
+		cv.shade(func(x, y float64) float64 { return ellipse(x, y, cx+side*10, cy+52, 6, 3.5, 2) }, 0.45)
+	}
+	cv.paint(func(x, y float64) float64 { return ellipse(x, y, cx, cy+10, 6, 40, 6) * 0.35 }, solid(skin.scale(1.12)))
+	cv.paint(func(x, y float64) float64 { return ellipse(x, y, cx, cy+44, 10, 8, 5) * 0.4 }, solid(skin.scale(1.1)))
+	cv.shade(func(x, y float64) float64 { return ellipse(x, y, cx, cy+60, 20, 6, 6) }, 0.2)
+
+	// Lips with a darker parting line, and a soft shadow under the lower lip
+	mouthY := cy + 92
+	cv.paint(func(x, y float64) float64 {
+		arc := 4 * math.Cos(math.Pi*(x-cx)/72)
+		return ellipse(x, y, cx, mouthY-5-arc*0.3, 34, 8, 2) + ellipse(x, y, cx, mouthY+6, 30, 10, 2)
+	}, func(x, y float64) rgb { return lips.scale(1.08 - 0.2*math.Abs(x-cx)/34) })
+	cv.paint(func(x, y float64) float64 {
+		return smoothstep(2, 0.5, math.Abs(y-mouthY-0.5)) * smoothstep(35, 30, math.Abs(x-cx))
+	}, solid(rgb{90, 44, 42}))
+	cv.shade(func(x, y float64) float64 { return ellipse(x, y, cx, mouthY+22, 22, 5, 5) }, 0.12)
+
+	// Fine grain so the face has some texture
+	rng := rand.New(rand.NewSource(p.seed))
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// 3x3 box blur softens the hard procedural edges
+			var sum rgb
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					p := cv[clamp(y+dy, height-1)][clamp(x+dx, width-1)]
+					sum = rgb{sum.r + p.r, sum.g + p.g, sum.b + p.b}
+				}
+			}
+			noise := rng.NormFloat64() * 2.5
+			out.Set(x, y, color.RGBA{
+				R: channel(sum.r/9 + noise),
+				G: channel(sum.g/9 + noise),
+				B: channel(sum.b/9 + noise),
+				A: 255,
+			})
+		}
+	}
+
+	return out
+}
+
+func save(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return jpeg.Encode(file, img, &jpeg.Options{Quality: 92})
+}
+
+func clamp(v, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func channel(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -3,12 +3,15 @@ module makeup-api
 go 1.21
 
 require (
-	github.com/gin-gonic/gin v1.9.1
-	github.com/gin-contrib/cors v1.4.0
-	gocv.io/x/gocv v0.32.1
 	github.com/disintegration/imaging v1.6.2
+	github.com/gin-contrib/cors v1.4.0
+	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.3.0
 	github.com/joho/godotenv v1.4.0
+	go.etcd.io/bbolt v1.3.7
+	gocv.io/x/gocv v0.32.1
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -31,11 +34,8 @@ require (
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
-	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8 // indirect
 	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.8.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
-
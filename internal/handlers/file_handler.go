@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"makeup-api/internal/models"
+	"makeup-api/internal/services"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FileHandler struct {
+	imageService *services.ImageService
+}
+
+func NewFileHandler(imageService *services.ImageService) *FileHandler {
+	return &FileHandler{
+		imageService: imageService,
+	}
+}
+
+// ServeUpload serves stored originals and results. Files are written once
+// under unique names, so they are cached as immutable; conditional and
+// Range requests are handled by http.ServeContent.
+func (h *FileHandler) ServeUpload(c *gin.Context) {
+	file, info, err := h.imageService.OpenUpload(c.Param("filepath"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "File not found",
+			Error:   "File " + c.Param("filepath") + " does not exist",
+		})
+		return
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(filepath.Ext(info.Name()), ".")
+	c.Header("Content-Type", services.ContentType(format))
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
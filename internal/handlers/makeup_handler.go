@@ -1,93 +1,201 @@
 package handlers
 
 import (
-	"net/http"
+	"errors"
+	"io"
 	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
 	"makeup-api/internal/services"
+	"net/http"
 	"path/filepath"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type MakeupHandler struct {
 	makeupService *services.MakeupService
 	imageService  *services.ImageService
+	jobQueue      *services.JobQueue
+	results       repository.ResultRepository
 }
 
-func NewMakeupHandler(makeupService *services.MakeupService, imageService *services.ImageService) *MakeupHandler {
+func NewMakeupHandler(makeupService *services.MakeupService, imageService *services.ImageService, jobQueue *services.JobQueue, results repository.ResultRepository) *MakeupHandler {
 	return &MakeupHandler{
 		makeupService: makeupService,
 		imageService:  imageService,
+		jobQueue:      jobQueue,
+		results:       results,
 	}
 }
 
-// UploadImage handles image upload requests
+// UploadImage handles image upload requests. Besides the JSON body with
+// base64 image_data it accepts multipart/form-data (file field "image") and
+// raw application/octet-stream or image/* bodies, which are streamed to disk.
 func (h *MakeupHandler) UploadImage(c *gin.Context) {
-	var req models.UploadRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
+	var uploadedImage *models.UploadedImage
+	var ok bool
+
+	switch contentType := c.ContentType(); {
+	case contentType == "multipart/form-data":
+		uploadedImage, ok = h.saveMultipartUpload(c)
+	case contentType == "application/octet-stream" || strings.HasPrefix(contentType, "image/"):
+		uploadedImage, ok = h.saveBinaryUpload(c)
+	default:
+		uploadedImage, ok = h.saveJSONUpload(c)
+	}
+	if !ok {
+		return
+	}
+
+	// Record the image so apply requests can resolve it by ID
+	if err := h.imageService.RegisterImage(uploadedImage); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Invalid request format",
+			Message: "Failed to register image",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Validate image format
-	if err := h.imageService.ValidateImageFormat(req.Format); err != nil {
+	// Tell the client straight away if the photo should be retaken (only
+	// when QUALITY_CHECK_ON_UPLOAD opts into detection on this request)
+	uploadedImage.Quality = h.makeupService.UploadQuality(uploadedImage.FilePath)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Image uploaded successfully",
+		Data:    uploadedImage,
+	})
+}
+
+// saveJSONUpload stores an image sent as base64 in a JSON body
+func (h *MakeupHandler) saveJSONUpload(c *gin.Context) (*models.UploadedImage, bool) {
+	var req models.UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Invalid image format",
+			Message: "Invalid request format",
 			Error:   err.Error(),
 		})
-		return
+		return nil, false
+	}
+
+	// Validate image format; when omitted it is detected from the content
+	if req.Format != "" {
+		if err := h.imageService.ValidateImageFormat(req.Format); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid image format",
+				Error:   err.Error(),
+			})
+			return nil, false
+		}
 	}
 
 	// Validate image size
 	if err := h.imageService.ValidateImageSize(req.ImageData); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
+		c.JSON(uploadErrorStatus(err), models.APIResponse{
 			Success: false,
 			Message: "Image validation failed",
 			Error:   err.Error(),
 		})
-		return
+		return nil, false
 	}
 
 	// Save the image
 	uploadedImage, err := h.imageService.SaveImageFromBase64(req.ImageData, req.Format)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to save image",
-			Error:   err.Error(),
-		})
-		return
+		respondUploadError(c, err)
+		return nil, false
 	}
+	return uploadedImage, true
+}
 
-	// Resize image if too large
-	if err := h.imageService.ResizeImage(uploadedImage.FilePath, 1920, 1080); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+// saveMultipartUpload streams the "image" part of a multipart form to disk.
+// The format comes from a "format" field or query parameter, falling back to
+// the part's Content-Type and file extension.
+func (h *MakeupHandler) saveMultipartUpload(c *gin.Context) (*models.UploadedImage, bool) {
+	// Leave headroom over the file limit for multipart boundaries and fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.imageService.MaxFileSize()+1<<20)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Failed to process image",
+			Message: "Invalid multipart request",
 			Error:   err.Error(),
 		})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Image uploaded successfully",
-		Data:    uploadedImage,
+	format := c.Query("format")
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid multipart request",
+				Error:   err.Error(),
+			})
+			return nil, false
+		}
+
+		switch part.FormName() {
+		case "format":
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			format = strings.TrimSpace(string(value))
+		case "image":
+			if format == "" {
+				format = formatFromContentType(part.Header.Get("Content-Type"))
+			}
+			if format == "" {
+				format = strings.TrimPrefix(filepath.Ext(part.FileName()), ".")
+			}
+
+			uploadedImage, err := h.imageService.SaveImageFromReader(part, format)
+			part.Close()
+			if err != nil {
+				respondUploadError(c, err)
+				return nil, false
+			}
+			return uploadedImage, true
+		}
+		part.Close()
+	}
+
+	c.JSON(http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Message: "Invalid multipart request",
+		Error:   "missing \"image\" file field",
 	})
+	return nil, false
+}
+
+// saveBinaryUpload streams a raw request body to disk. The format comes from
+// the "format" query parameter or an image/* Content-Type, and is detected
+// from the content when neither is given.
+func (h *MakeupHandler) saveBinaryUpload(c *gin.Context) (*models.UploadedImage, bool) {
+	format := c.Query("format")
+	if format == "" {
+		format = formatFromContentType(c.ContentType())
+	}
+
+	uploadedImage, err := h.imageService.SaveImageFromReader(c.Request.Body, format)
+	if err != nil {
+		respondUploadError(c, err)
+		return nil, false
+	}
+	return uploadedImage, true
 }
 
 // ApplyMakeupStyle handles makeup application requests
 func (h *MakeupHandler) ApplyMakeupStyle(c *gin.Context) {
 	styleID := c.Param("style")
-	
+
 	var req models.MakeupApplicationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -99,8 +207,7 @@ func (h *MakeupHandler) ApplyMakeupStyle(c *gin.Context) {
 	}
 
 	// Validate style exists
-	style, exists := h.makeupService.GetStyle(styleID)
-	if !exists {
+	if _, exists := h.makeupService.GetStyle(styleID); !exists {
 		c.JSON(http.StatusNotFound, models.APIResponse{
 			Success: false,
 			Message: "Makeup style not found",
@@ -109,51 +216,84 @@ func (h *MakeupHandler) ApplyMakeupStyle(c *gin.Context) {
 		return
 	}
 
-	// Check if image exists
-	imagePath := filepath.Join("uploads", req.ImageID+".jpg")
-	if _, err := filepath.Abs(imagePath); err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+	// Validate the requested output format
+	if req.OutputFormat != "" {
+		if err := h.imageService.ValidateImageFormat(req.OutputFormat); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid output format",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	// Validate which faces to apply to
+	faces, err := services.ParseFaceSelection(req.FaceSelection, req.FaceIndex, req.FaceBox)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Image not found",
-			Error:   "Image " + req.ImageID + " does not exist",
+			Message: "Invalid face selection",
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Create processing result record
-	resultID := uuid.New().String()
-	result := models.ProcessingResult{
-		ID:         resultID,
-		OriginalID: req.ImageID,
-		StyleID:    styleID,
-		Status:     "processing",
-		CreatedAt:  time.Now(),
+	// Resolve the uploaded image through the registry
+	image, ok := h.lookupImage(c, req.ImageID)
+	if !ok {
+		return
 	}
 
-	// Apply makeup style (this would typically be done asynchronously)
-	resultPath, err := h.makeupService.ApplyMakeupStyle(imagePath, styleID)
+	// Hand the work to the worker pool; clients poll the result endpoint
+	result, err := h.jobQueue.Enqueue(image.ID, image.FilePath, services.ApplyOptions{
+		StyleID:      styleID,
+		OutputFormat: req.OutputFormat,
+		Faces:        faces,
+	})
 	if err != nil {
-		result.Status = "failed"
-		result.Error = err.Error()
-		result.CompletedAt = time.Now()
-		
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrQueueFull) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, models.APIResponse{
 			Success: false,
-			Message: "Failed to apply makeup style",
+			Message: "Failed to queue makeup application",
 			Error:   err.Error(),
-			Data:    result,
 		})
 		return
 	}
 
-	// Update result with success
-	result.Status = "completed"
-	result.ResultURL = h.imageService.GetImageURL(resultPath)
-	result.CompletedAt = time.Now()
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Makeup application queued",
+		Data:    result,
+	})
+}
+
+// GetImageFaces detects the faces in an uploaded image and reports their
+// boxes, landmarks and quality, so clients can check the photo and pick a
+// face before applying a style.
+func (h *MakeupHandler) GetImageFaces(c *gin.Context) {
+	image, ok := h.lookupImage(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	result, err := h.makeupService.AnalyzeFaces(image.FilePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to detect faces",
+			Error:   err.Error(),
+		})
+		return
+	}
+	result.ImageID = image.ID
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
-		Message: "Makeup applied successfully",
+		Message: "Faces detected successfully",
 		Data:    result,
 	})
 }
@@ -161,7 +301,7 @@ func (h *MakeupHandler) ApplyMakeupStyle(c *gin.Context) {
 // GetAvailableStyles returns all available makeup styles
 func (h *MakeupHandler) GetAvailableStyles(c *gin.Context) {
 	styles := h.makeupService.GetAvailableStyles()
-	
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Styles retrieved successfully",
@@ -172,15 +312,10 @@ func (h *MakeupHandler) GetAvailableStyles(c *gin.Context) {
 // GetResult retrieves a processing result
 func (h *MakeupHandler) GetResult(c *gin.Context) {
 	resultID := c.Param("id")
-	
-	// In a real implementation, you would store and retrieve results from a database
-	// For now, we'll return a mock response
-	result := models.ProcessingResult{
-		ID:         resultID,
-		Status:     "completed",
-		ResultURL:  "/uploads/results/" + resultID + ".jpg",
-		CreatedAt:  time.Now().Add(-5 * time.Minute),
-		CompletedAt: time.Now().Add(-2 * time.Minute),
+
+	result, ok := h.lookupResult(c, resultID)
+	if !ok {
+		return
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -193,7 +328,7 @@ func (h *MakeupHandler) GetResult(c *gin.Context) {
 // GetStyleDetails returns details for a specific makeup style
 func (h *MakeupHandler) GetStyleDetails(c *gin.Context) {
 	styleID := c.Param("style")
-	
+
 	style, exists := h.makeupService.GetStyle(styleID)
 	if !exists {
 		c.JSON(http.StatusNotFound, models.APIResponse{
@@ -214,23 +349,10 @@ func (h *MakeupHandler) GetStyleDetails(c *gin.Context) {
 // GetProcessingStatus returns the status of a makeup application
 func (h *MakeupHandler) GetProcessingStatus(c *gin.Context) {
 	resultID := c.Param("id")
-	
-	// Mock processing status
-	status := c.Query("status")
-	if status == "" {
-		status = "completed"
-	}
-
-	result := models.ProcessingResult{
-		ID:         resultID,
-		Status:     status,
-		ResultURL:  "/uploads/results/" + resultID + ".jpg",
-		CreatedAt:  time.Now().Add(-10 * time.Minute),
-		CompletedAt: time.Now().Add(-5 * time.Minute),
-	}
 
-	if status == "failed" {
-		result.Error = "Processing failed due to face detection issues"
+	result, ok := h.lookupResult(c, resultID)
+	if !ok {
+		return
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -240,3 +362,78 @@ func (h *MakeupHandler) GetProcessingStatus(c *gin.Context) {
 	})
 }
 
+// lookupImage resolves an uploaded image through the registry, writing the
+// error response itself when the image is unknown or the store fails.
+func (h *MakeupHandler) lookupImage(c *gin.Context, imageID string) (models.UploadedImage, bool) {
+	image, err := h.imageService.GetImage(imageID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Image not found",
+			Error:   "Image " + imageID + " does not exist",
+		})
+		return image, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to look up image",
+			Error:   err.Error(),
+		})
+		return image, false
+	}
+	return image, true
+}
+
+// lookupResult loads a stored result, writing the error response itself when
+// the result is unknown or the store fails.
+func (h *MakeupHandler) lookupResult(c *gin.Context, resultID string) (models.ProcessingResult, bool) {
+	result, err := h.results.Get(resultID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Result not found",
+			Error:   "Result " + resultID + " does not exist",
+		})
+		return result, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve result",
+			Error:   err.Error(),
+		})
+		return result, false
+	}
+	return result, true
+}
+
+// formatFromContentType maps an image/* MIME type to an upload format
+func formatFromContentType(contentType string) string {
+	if !strings.HasPrefix(contentType, "image/") {
+		return ""
+	}
+	return strings.TrimPrefix(contentType, "image/")
+}
+
+// uploadErrorStatus maps image service errors to HTTP status codes
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge), errors.Is(err, services.ErrTooManyPixels):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUnsupportedFormat), errors.Is(err, services.ErrInvalidBase64):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrFormatMismatch), errors.Is(err, services.ErrInvalidImage):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func respondUploadError(c *gin.Context, err error) {
+	c.JSON(uploadErrorStatus(err), models.APIResponse{
+		Success: false,
+		Message: "Failed to save image",
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"makeup-api/internal/services"
+	"net/http"
+	"testing"
+)
+
+func TestUploadErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: 1 bytes", services.ErrFileTooLarge), http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: 1x1", services.ErrTooManyPixels), http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: gif", services.ErrUnsupportedFormat), http.StatusBadRequest},
+		{fmt.Errorf("%w: illegal data", services.ErrInvalidBase64), http.StatusBadRequest},
+		{fmt.Errorf("%w: truncated", services.ErrInvalidImage), http.StatusUnprocessableEntity},
+		{services.ErrFormatMismatch, http.StatusUnprocessableEntity},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := uploadErrorStatus(tt.err); got != tt.want {
+			t.Errorf("uploadErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
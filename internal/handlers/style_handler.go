@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
+	"makeup-api/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStyleSize caps style definition request bodies
+const maxStyleSize = 1 << 20
+
+// CreateStyle adds a new style from a JSON (or application/yaml) body
+func (h *MakeupHandler) CreateStyle(c *gin.Context) {
+	style, ok := readStyle(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.makeupService.CreateStyle(style)
+	if err != nil {
+		h.respondStyleError(c, style.ID, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Style created successfully",
+		Data:    created,
+	})
+}
+
+// UpdateStyle replaces a style. The body must carry the version it was
+// based on; a stale version is rejected with 409 and the current style.
+func (h *MakeupHandler) UpdateStyle(c *gin.Context) {
+	styleID := c.Param("style")
+
+	style, ok := readStyle(c)
+	if !ok {
+		return
+	}
+	if style.ID == "" {
+		style.ID = styleID
+	}
+	if style.ID != styleID {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid style",
+			Error:   "Style id " + style.ID + " does not match the URL",
+		})
+		return
+	}
+	if style.Version <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid style",
+			Error:   "version is required",
+		})
+		return
+	}
+
+	updated, err := h.makeupService.UpdateStyle(style)
+	if err != nil {
+		h.respondStyleError(c, styleID, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Style updated successfully",
+		Data:    updated,
+	})
+}
+
+// DeleteStyle removes a style; the current version is required as the
+// "version" query parameter
+func (h *MakeupHandler) DeleteStyle(c *gin.Context) {
+	styleID := c.Param("style")
+
+	version, err := strconv.Atoi(c.Query("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request",
+			Error:   "version query parameter is required",
+		})
+		return
+	}
+
+	if err := h.makeupService.DeleteStyle(styleID, version); err != nil {
+		h.respondStyleError(c, styleID, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Style deleted successfully",
+	})
+}
+
+// readStyle decodes a style definition body, rejecting unknown fields
+func readStyle(c *gin.Context) (models.MakeupStyle, bool) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxStyleSize+1))
+	if err == nil && len(data) > maxStyleSize {
+		err = errors.New("style definition is too large")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return models.MakeupStyle{}, false
+	}
+
+	style, err := services.DecodeStyle(data, strings.Contains(c.ContentType(), "yaml"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid style",
+			Error:   err.Error(),
+		})
+		return style, false
+	}
+	return style, true
+}
+
+// respondStyleError maps style management errors to HTTP responses
+func (h *MakeupHandler) respondStyleError(c *gin.Context, styleID string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidStyle):
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid style",
+			Error:   err.Error(),
+		})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Style not found",
+			Error:   "Style " + styleID + " does not exist",
+		})
+	case errors.Is(err, repository.ErrAlreadyExists):
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Style already exists",
+			Error:   "Style " + styleID + " already exists",
+		})
+	case errors.Is(err, repository.ErrVersionConflict):
+		current, _ := h.makeupService.GetStyle(styleID)
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Style was modified",
+			Error:   "Style " + styleID + " has changed since the given version; reload and retry",
+			Data:    current,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save style",
+			Error:   err.Error(),
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -69,3 +71,31 @@ func RequestSizeLimit(maxSize int64) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminAuth middleware requires "Authorization: Bearer <token>". With an
+// empty token the guarded routes are disabled.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.JSON(403, gin.H{
+				"success": false,
+				"message": "Forbidden",
+				"error":   "Admin endpoints are disabled (ADMIN_TOKEN is not set)",
+			})
+			c.Abort()
+			return
+		}
+
+		provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(401, gin.H{
+				"success": false,
+				"message": "Unauthorized",
+				"error":   "Missing or invalid admin token",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
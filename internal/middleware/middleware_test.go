@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"bare token without scheme", "secret", "secret", http.StatusUnauthorized},
+		{"other scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"lower-case scheme", "secret", "bearer secret", http.StatusUnauthorized},
+		{"token prefix only", "secret", "Bearer secre", http.StatusUnauthorized},
+		{"disabled", "", "Bearer ", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/admin", AdminAuth(tt.token), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -9,33 +9,242 @@ type MakeupStyle struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Category    string `json:"category"` // bridal, editorial, everyday, special-event
-	Intensity   int    `json:"intensity"` // 1-10 scale
-	PreviewURL  string `json:"preview_url,omitempty"`
+	Category    string `json:"category"`  // bridal, editorial, everyday, special-event
+	Intensity   int    `json:"intensity"` // 1-10, scales every layer; 5 draws them as written
+	// PreviewURL is the first of PreviewURLs, the style rendered onto each
+	// reference face; both are generated and never stored
+	PreviewURL  string   `json:"preview_url,omitempty"`
+	PreviewURLs []string `json:"preview_urls,omitempty"`
+	// Version increases with every change; updates must send the version
+	// they were based on
+	Version int `json:"version"`
+
+	// Layers are applied to each face in order
+	Layers []EffectLayer `json:"layers"`
+}
+
+// Effect layer types
+const (
+	LayerSkin        = "skin"        // edge-preserving smoothing of the skin
+	LayerFoundation  = "foundation"  // evens out skin tone
+	LayerLipstick    = "lipstick"    // recolours the lips
+	LayerEyeshadow   = "eyeshadow"   // shades the lids
+	LayerEyeliner    = "eyeliner"    // strokes the upper lash line
+	LayerMascara     = "mascara"     // darkens the lashes
+	LayerContour     = "contour"     // sculpts by face shape
+	LayerBlush       = "blush"       // flushes the cheek apples
+	LayerHighlighter = "highlighter" // brightens the high points
+	LayerTint        = "tint"        // colours a named region
+)
+
+// Blend modes for colour layers
+const (
+	BlendNormal    = "normal"
+	BlendMultiply  = "multiply"
+	BlendScreen    = "screen"
+	BlendOverlay   = "overlay"
+	BlendSoftLight = "soft_light"
+)
+
+// Regions a tint layer can colour
+const (
+	RegionFace     = "face"
+	RegionLips     = "lips"
+	RegionCheeks   = "cheeks"
+	RegionEyelids  = "eyelids"
+	RegionJaw      = "jaw"
+	RegionForehead = "forehead"
+)
+
+// Highlighter regions
+const (
+	HighlightCheekbones = "cheekbones"
+	HighlightNoseBridge = "nose_bridge"
+	HighlightCupidsBow  = "cupids_bow"
+)
+
+// Lipstick finishes
+const (
+	FinishMatte    = "matte"
+	FinishSatin    = "satin"
+	FinishGloss    = "gloss"
+	FinishMetallic = "metallic"
+)
+
+// EffectLayer is one step of a style. Which regions, blend modes and
+// parameters apply depends on the type.
+type EffectLayer struct {
+	Type      string                 `json:"type"`
+	Region    string                 `json:"region,omitempty"`
+	Color     string                 `json:"color,omitempty"`      // hex RGB, e.g. #C8323C
+	Shade     *Shade                 `json:"shade,omitempty"`      // used instead of color when set
+	Opacity   float64                `json:"opacity"`              // 0-1 strength
+	BlendMode string                 `json:"blend_mode,omitempty"` // defaults per type
+	Params    map[string]interface{} `json:"params,omitempty"`
+}
+
+// Shade picks a colour relative to the wearer's detected skin tone instead
+// of a fixed one. Offsets are in CIELAB units and added to the skin colour.
+type Shade struct {
+	Depth  float64 `json:"depth"`  // L* offset; negative is deeper, positive lighter
+	Red    float64 `json:"red"`    // a* offset; positive is rosier, negative greener
+	Yellow float64 `json:"yellow"` // b* offset; positive is warmer, negative cooler
 }
 
+// Face shapes used to place contour
+const (
+	FaceShapeOval   = "oval"
+	FaceShapeRound  = "round"
+	FaceShapeSquare = "square"
+	FaceShapeHeart  = "heart"
+	FaceShapeLong   = "long"
+)
+
 // UploadRequest represents the image upload request
 type UploadRequest struct {
 	ImageData string `json:"image_data" binding:"required"` // base64 encoded image
-	Format    string `json:"format"`                         // jpeg, png, webp
+	Format    string `json:"format"`                        // jpeg, png, webp
 }
 
 // MakeupApplicationRequest represents the makeup application request
 type MakeupApplicationRequest struct {
-	ImageID string `json:"image_id" binding:"required"`
-	StyleID string `json:"style_id" binding:"required"`
+	ImageID      string `json:"image_id" binding:"required"`
+	StyleID      string `json:"style_id" binding:"required"`
+	OutputFormat string `json:"output_format"` // jpeg (default), png, webp
+	// FaceSelection picks the faces to edit: largest (default), all, index or box
+	FaceSelection string   `json:"face_selection"`
+	FaceIndex     *int     `json:"face_index,omitempty"` // with face_selection "index"
+	FaceBox       *FaceBox `json:"face_box,omitempty"`   // with face_selection "box"
+}
+
+// FaceBox is a face bounding box in image pixel coordinates
+type FaceBox struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Point is a pixel position in image coordinates
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// FaceQuality holds raw image quality measurements over a face box
+type FaceQuality struct {
+	Sharpness     float64 `json:"sharpness"`      // variance of the Laplacian; low means blurry
+	Brightness    float64 `json:"brightness"`     // mean luma, 0-255
+	Contrast      float64 `json:"contrast"`       // luma standard deviation
+	ShadowClip    float64 `json:"shadow_clip"`    // fraction of face pixels crushed to black
+	HighlightClip float64 `json:"highlight_clip"` // fraction of face pixels blown to white
+	FaceRatio     float64 `json:"face_ratio"`     // face area as a fraction of the image
+	SkinCoverage  float64 `json:"skin_coverage"`  // fraction of the inner face that looks like skin
+	// Pose is only estimated from measured landmarks
+	Pose *HeadPose `json:"pose,omitempty"`
+}
+
+// HeadPose is a rough head orientation in degrees, 0 when facing the camera
+type HeadPose struct {
+	Yaw   float64 `json:"yaw"`   // turned left/right
+	Pitch float64 `json:"pitch"` // tilted up/down
+	Roll  float64 `json:"roll"`  // tilted towards a shoulder
+}
+
+// Quality issue severities
+const (
+	SeverityError   = "error"   // the photo should be retaken
+	SeverityWarning = "warning" // results may suffer
+)
+
+// QualityIssue is a machine-readable problem found in a photo, with a tip
+// that can be shown to the user
+type QualityIssue struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Tip      string `json:"tip"`
+	Face     *int   `json:"face,omitempty"` // index of the affected face
+}
+
+// QualityReport summarises whether a photo is usable for makeup application
+type QualityReport struct {
+	Acceptable bool           `json:"acceptable"` // no error-severity issues
+	FaceCount  int            `json:"face_count"`
+	Checked    []int          `json:"checked_faces"` // faces the report covers
+	Issues     []QualityIssue `json:"issues"`
+}
+
+// FaceAnalysis describes one detected face without applying makeup
+type FaceAnalysis struct {
+	Index int     `json:"index"`
+	Box   FaceBox `json:"box"`
+	// Landmarks are the 68 iBUG points; estimated ones come from an average
+	// face shape rather than a landmark model
+	Landmarks          []Point        `json:"landmarks,omitempty"`
+	LandmarksEstimated bool           `json:"landmarks_estimated"`
+	Shape              string         `json:"shape,omitempty"` // oval, round, square, heart, long
+	SkinTone           *SkinTone      `json:"skin_tone,omitempty"`
+	Quality            FaceQuality    `json:"quality"`
+	Issues             []QualityIssue `json:"issues"`
 }
 
+// Skin undertones
+const (
+	UndertoneWarm    = "warm"
+	UndertoneNeutral = "neutral"
+	UndertoneCool    = "cool"
+)
+
+// SkinTone is the complexion measured over the segmented skin of a face
+type SkinTone struct {
+	Color     string  `json:"color"`      // mean skin colour, hex RGB
+	MonkScale int     `json:"monk_scale"` // 1 (lightest) to 10 (deepest)
+	Undertone string  `json:"undertone"`  // warm, neutral, cool
+	Lightness float64 `json:"lightness"`  // CIELAB L*, 0-100
+	Hue       float64 `json:"hue"`        // CIELAB hue angle in degrees
+}
+
+// FaceDetectionResult is the response of the face detection endpoint
+type FaceDetectionResult struct {
+	ImageID string         `json:"image_id"`
+	Width   int            `json:"width"`
+	Height  int            `json:"height"`
+	Faces   []FaceAnalysis `json:"faces"`
+	// DefaultFace is the index edited when no face_selection is given, -1 without faces
+	DefaultFace int `json:"default_face"`
+}
+
+// DetectedFace reports a face found in the image and whether makeup was applied to it
+type DetectedFace struct {
+	Index     int     `json:"index"`
+	Box       FaceBox `json:"box"`
+	Processed bool    `json:"processed"`
+}
+
+// Processing statuses reported on a ProcessingResult
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
 // ProcessingResult represents the result of makeup processing
 type ProcessingResult struct {
-	ID          string    `json:"id"`
-	OriginalID  string    `json:"original_id"`
-	StyleID     string    `json:"style_id"`
-	Status      string    `json:"status"` // processing, completed, failed
-	ResultURL   string    `json:"result_url,omitempty"`
-	Error       string    `json:"error,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	CompletedAt time.Time `json:"completed_at,omitempty"`
+	ID         string `json:"id"`
+	OriginalID string `json:"original_id"`
+	StyleID    string `json:"style_id"`
+	Status     string `json:"status"` // processing, completed, failed
+	ResultURL  string `json:"result_url,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Faces lists every detected face once processing has run
+	Faces   []DetectedFace `json:"faces,omitempty"`
+	Quality *QualityReport `json:"quality,omitempty"`
+	// LandmarksEstimated is set when no landmark model was configured and
+	// makeup was placed on an average face shape
+	LandmarksEstimated bool      `json:"landmarks_estimated,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	CompletedAt        time.Time `json:"completed_at,omitempty"`
 }
 
 // UploadedImage represents an uploaded image
@@ -45,7 +254,11 @@ type UploadedImage struct {
 	FilePath  string    `json:"file_path"`
 	Format    string    `json:"format"`
 	Size      int64     `json:"size"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
 	CreatedAt time.Time `json:"created_at"`
+	// Quality is the pre-check reported with the upload response
+	Quality *QualityReport `json:"quality,omitempty"`
 }
 
 // APIResponse represents a standard API response
@@ -55,4 +268,3 @@ type APIResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
 }
-
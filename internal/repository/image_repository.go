@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"makeup-api/internal/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var imagesBucket = []byte("images")
+
+// ImageRepository stores metadata for uploaded images keyed by image ID
+type ImageRepository interface {
+	Save(image models.UploadedImage) error
+	Get(id string) (models.UploadedImage, error)
+}
+
+// BoltImageRepository stores image metadata as JSON documents in bbolt
+type BoltImageRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltImageRepository(db *bolt.DB) (*BoltImageRepository, error) {
+	if err := ensureBucket(db, imagesBucket); err != nil {
+		return nil, fmt.Errorf("failed to create images bucket: %v", err)
+	}
+	return &BoltImageRepository{db: db}, nil
+}
+
+func (r *BoltImageRepository) Save(image models.UploadedImage) error {
+	data, err := json.Marshal(image)
+	if err != nil {
+		return fmt.Errorf("failed to encode image metadata: %v", err)
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(imagesBucket).Put([]byte(image.ID), data)
+	})
+}
+
+func (r *BoltImageRepository) Get(id string) (models.UploadedImage, error) {
+	var image models.UploadedImage
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(imagesBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &image)
+	})
+	return image, err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"makeup-api/internal/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var resultsBucket = []byte("results")
+
+// ResultRepository persists makeup processing results
+type ResultRepository interface {
+	Save(result models.ProcessingResult) error
+	Get(id string) (models.ProcessingResult, error)
+	ListByStatus(status string) ([]models.ProcessingResult, error)
+	Delete(id string) error
+}
+
+// BoltResultRepository stores results as JSON documents in bbolt
+type BoltResultRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltResultRepository(db *bolt.DB) (*BoltResultRepository, error) {
+	if err := ensureBucket(db, resultsBucket); err != nil {
+		return nil, fmt.Errorf("failed to create results bucket: %v", err)
+	}
+	return &BoltResultRepository{db: db}, nil
+}
+
+func (r *BoltResultRepository) Save(result models.ProcessingResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %v", err)
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Put([]byte(result.ID), data)
+	})
+}
+
+func (r *BoltResultRepository) Get(id string) (models.ProcessingResult, error) {
+	var result models.ProcessingResult
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(resultsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &result)
+	})
+	return result, err
+}
+
+func (r *BoltResultRepository) Delete(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Delete([]byte(id))
+	})
+}
+
+func (r *BoltResultRepository) ListByStatus(status string) ([]models.ProcessingResult, error) {
+	var results []models.ProcessingResult
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).ForEach(func(_, data []byte) error {
+			var result models.ProcessingResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				return err
+			}
+			if result.Status == status {
+				results = append(results, result)
+			}
+			return nil
+		})
+	})
+	return results, err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"errors"
+	"makeup-api/internal/models"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestResultRepository(t *testing.T) *BoltResultRepository {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewBoltResultRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestResultRepositorySaveAndGet(t *testing.T) {
+	repo := newTestResultRepository(t)
+
+	if _, err := repo.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get of unknown result: error = %v, want ErrNotFound", err)
+	}
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := models.ProcessingResult{
+		ID:         "r1",
+		OriginalID: "image-1",
+		StyleID:    "natural",
+		Status:     models.StatusProcessing,
+		CreatedAt:  created,
+	}
+	if err := repo.Save(result); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OriginalID != "image-1" || got.StyleID != "natural" || got.Status != models.StatusProcessing || !got.CreatedAt.Equal(created) {
+		t.Errorf("got %+v, want %+v", got, result)
+	}
+
+	// Saving again replaces the stored result
+	result.Status = models.StatusCompleted
+	result.ResultURL = "/uploads/results/r1.jpg"
+	if err := repo.Save(result); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.Get("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusCompleted || got.ResultURL != result.ResultURL {
+		t.Errorf("got %s %q after update, want completed with its URL", got.Status, got.ResultURL)
+	}
+}
+
+func TestResultRepositoryListByStatus(t *testing.T) {
+	repo := newTestResultRepository(t)
+	for _, result := range []models.ProcessingResult{
+		{ID: "a", Status: models.StatusProcessing},
+		{ID: "b", Status: models.StatusCompleted},
+		{ID: "c", Status: models.StatusProcessing},
+		{ID: "d", Status: models.StatusFailed},
+	} {
+		if err := repo.Save(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		status string
+		want   []string
+	}{
+		{models.StatusProcessing, []string{"a", "c"}},
+		{models.StatusCompleted, []string{"b"}},
+		{models.StatusFailed, []string{"d"}},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			results, err := repo.ListByStatus(tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			sort.Strings(ids)
+			if len(ids) != len(tt.want) {
+				t.Fatalf("got %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResultRepositoryDelete(t *testing.T) {
+	repo := newTestResultRepository(t)
+	for _, id := range []string{"keep", "drop"} {
+		if err := repo.Save(models.ProcessingResult{ID: id, Status: models.StatusProcessing}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.Delete("drop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get("drop"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete: error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.Get("keep"); err != nil {
+		t.Errorf("delete removed another result: %v", err)
+	}
+
+	// Deleting an unknown result is not an error
+	if err := repo.Delete("missing"); err != nil {
+		t.Errorf("delete of unknown result: %v", err)
+	}
+	if results, err := repo.ListByStatus(models.StatusProcessing); err != nil || len(results) != 1 {
+		t.Errorf("processing results = %+v (%v), want only keep", results, err)
+	}
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"makeup-api/internal/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	stylesBucket        = []byte("styles")
+	deletedStylesBucket = []byte("deleted_styles")
+	// seededStylesBucket holds, by style ID, the hash of the definition a
+	// style was last seeded from, or createdMarker for styles created
+	// through the API
+	seededStylesBucket = []byte("seeded_styles")
+)
+
+// createdMarker never matches a definition hash, so seeding leaves styles
+// created through the API alone
+var createdMarker = []byte("created")
+
+// ErrAlreadyExists is returned when creating a record whose ID is taken
+var ErrAlreadyExists = errors.New("record already exists")
+
+// ErrVersionConflict is returned when a record changed since the version
+// the caller last read
+var ErrVersionConflict = errors.New("version conflict")
+
+// StyleRepository persists makeup styles. Every write bumps the style's
+// version, and updates and deletes must name the version they replace.
+type StyleRepository interface {
+	List() ([]models.MakeupStyle, error)
+	Seed(styles []models.MakeupStyle) (SeedResult, error)
+	Create(style models.MakeupStyle) (models.MakeupStyle, error)
+	Update(style models.MakeupStyle) (models.MakeupStyle, error)
+	Delete(id string, version int) error
+}
+
+// SeedResult lists the style IDs seeding added or changed, and those whose
+// definition changed after they were edited through the API
+type SeedResult struct {
+	Added    []string
+	Updated  []string
+	Diverged []string // left as edited
+}
+
+// BoltStyleRepository stores styles as JSON documents in bbolt. IDs of
+// deleted styles are remembered so seeding doesn't bring them back.
+type BoltStyleRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltStyleRepository(db *bolt.DB) (*BoltStyleRepository, error) {
+	for _, name := range [][]byte{stylesBucket, deletedStylesBucket, seededStylesBucket} {
+		if err := ensureBucket(db, name); err != nil {
+			return nil, fmt.Errorf("failed to create %s bucket: %v", name, err)
+		}
+	}
+	return &BoltStyleRepository{db: db}, nil
+}
+
+func (r *BoltStyleRepository) List() ([]models.MakeupStyle, error) {
+	var styles []models.MakeupStyle
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(stylesBucket).ForEach(func(_, data []byte) error {
+			var style models.MakeupStyle
+			if err := json.Unmarshal(data, &style); err != nil {
+				return err
+			}
+			styles = append(styles, style)
+			return nil
+		})
+	})
+	return styles, err
+}
+
+// Seed adds the styles that are neither stored nor deleted, at version 1.
+// A stored style whose definition changed since it was seeded is replaced
+// by the new definition as the next version, unless it was edited or
+// created through the API since; those are left as they are and reported
+// as diverged.
+func (r *BoltStyleRepository) Seed(styles []models.MakeupStyle) (SeedResult, error) {
+	var result SeedResult
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stylesBucket)
+		deleted := tx.Bucket(deletedStylesBucket)
+		seeded := tx.Bucket(seededStylesBucket)
+		for _, style := range styles {
+			id := []byte(style.ID)
+			if deleted.Get(id) != nil {
+				continue
+			}
+			hash, err := DefinitionHash(style)
+			if err != nil {
+				return err
+			}
+
+			current, err := getStyle(bucket, style.ID)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				style.Version = 1
+				result.Added = append(result.Added, style.ID)
+			case err != nil:
+				return err
+			default:
+				recorded := seeded.Get(id)
+				if string(recorded) == hash {
+					continue
+				}
+				stored, err := DefinitionHash(current)
+				if err != nil {
+					return err
+				}
+				if stored == hash {
+					// Already matches the file, only the record is missing
+					if err := seeded.Put(id, []byte(hash)); err != nil {
+						return err
+					}
+					continue
+				}
+				// Styles stored before seeds were recorded are unedited
+				// while still at their first version
+				unedited := string(recorded) == stored || (recorded == nil && current.Version == 1)
+				if !unedited {
+					result.Diverged = append(result.Diverged, style.ID)
+					continue
+				}
+				style.Version = current.Version + 1
+				result.Updated = append(result.Updated, style.ID)
+			}
+
+			if err := putStyle(bucket, style); err != nil {
+				return err
+			}
+			if err := seeded.Put(id, []byte(hash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return SeedResult{}, err
+	}
+	return result, nil
+}
+
+func (r *BoltStyleRepository) Create(style models.MakeupStyle) (models.MakeupStyle, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stylesBucket)
+		if bucket.Get([]byte(style.ID)) != nil {
+			return ErrAlreadyExists
+		}
+		style.Version = 1
+		if err := tx.Bucket(deletedStylesBucket).Delete([]byte(style.ID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(seededStylesBucket).Put([]byte(style.ID), createdMarker); err != nil {
+			return err
+		}
+		return putStyle(bucket, style)
+	})
+	return style, err
+}
+
+// Update replaces the stored style if style.Version is still current
+func (r *BoltStyleRepository) Update(style models.MakeupStyle) (models.MakeupStyle, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stylesBucket)
+		current, err := getStyle(bucket, style.ID)
+		if err != nil {
+			return err
+		}
+		if current.Version != style.Version {
+			return ErrVersionConflict
+		}
+		style.Version = current.Version + 1
+		return putStyle(bucket, style)
+	})
+	return style, err
+}
+
+// Delete removes the style if version is still current
+func (r *BoltStyleRepository) Delete(id string, version int) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stylesBucket)
+		current, err := getStyle(bucket, id)
+		if err != nil {
+			return err
+		}
+		if current.Version != version {
+			return ErrVersionConflict
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return tx.Bucket(deletedStylesBucket).Put([]byte(id), []byte{})
+	})
+}
+
+func getStyle(bucket *bolt.Bucket, id string) (models.MakeupStyle, error) {
+	var style models.MakeupStyle
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return style, ErrNotFound
+	}
+	err := json.Unmarshal(data, &style)
+	return style, err
+}
+
+// DefinitionHash identifies a style's definition, ignoring its version and
+// generated preview URLs
+func DefinitionHash(style models.MakeupStyle) (string, error) {
+	style.Version = 0
+	style.PreviewURL = ""
+	style.PreviewURLs = nil
+	data, err := json.Marshal(style)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode style: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func putStyle(bucket *bolt.Bucket, style models.MakeupStyle) error {
+	data, err := json.Marshal(style)
+	if err != nil {
+		return fmt.Errorf("failed to encode style: %v", err)
+	}
+	return bucket.Put([]byte(style.ID), data)
+}
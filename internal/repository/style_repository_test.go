@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"errors"
+	"makeup-api/internal/models"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStyleRepository(t *testing.T) *BoltStyleRepository {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "styles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewBoltStyleRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func style(id, name string) models.MakeupStyle {
+	return models.MakeupStyle{ID: id, Name: name, Intensity: 5}
+}
+
+// stored returns the listed styles by ID
+func stored(t *testing.T, repo *BoltStyleRepository) map[string]models.MakeupStyle {
+	t.Helper()
+	styles, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]models.MakeupStyle)
+	for _, s := range styles {
+		byID[s.ID] = s
+	}
+	return byID
+}
+
+func TestStyleRepositorySeed(t *testing.T) {
+	repo := newTestStyleRepository(t)
+
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural"), style("bridal", "Bridal")}); err != nil {
+		t.Fatal(err)
+	}
+	styles := stored(t, repo)
+	if len(styles) != 2 || styles["natural"].Version != 1 || styles["bridal"].Version != 1 {
+		t.Fatalf("seeded styles = %+v, want natural and bridal at version 1", styles)
+	}
+
+	// Edits and deletions made through the API survive a re-seed
+	edited := styles["natural"]
+	edited.Name = "Edited"
+	if _, err := repo.Update(edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("bridal", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural"), style("bridal", "Bridal")}); err != nil {
+		t.Fatal(err)
+	}
+
+	styles = stored(t, repo)
+	if got := styles["natural"]; got.Name != "Edited" || got.Version != 2 {
+		t.Errorf("natural = %q v%d after re-seed, want the edit at v2", got.Name, got.Version)
+	}
+	if _, ok := styles["bridal"]; ok {
+		t.Error("re-seeding restored a deleted style")
+	}
+}
+
+func TestStyleRepositorySeedChangedDefinitions(t *testing.T) {
+	repo := newTestStyleRepository(t)
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural"), style("bridal", "Bridal")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// bridal is edited through the API, then both files change
+	bridal := stored(t, repo)["bridal"]
+	bridal.Description = "Edited"
+	if _, err := repo.Update(bridal); err != nil {
+		t.Fatal(err)
+	}
+	created, err := repo.Create(style("glam", "Glam"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := []models.MakeupStyle{
+		style("natural", "Natural v2"),
+		style("bridal", "Bridal v2"),
+		style("glam", "Glam from a file"),
+		style("new", "New"),
+	}
+	result, err := repo.Seed(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SeedResult{Added: []string{"new"}, Updated: []string{"natural"}, Diverged: []string{"bridal", "glam"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("seed result = %+v, want %+v", result, want)
+	}
+
+	styles := stored(t, repo)
+	if got := styles["natural"]; got.Name != "Natural v2" || got.Version != 2 {
+		t.Errorf("natural = %q v%d, want the new definition at v2", got.Name, got.Version)
+	}
+	if got := styles["bridal"]; got.Description != "Edited" || got.Version != 2 {
+		t.Errorf("bridal = %+v, want the API edit kept", got)
+	}
+	if got := styles["glam"]; got.Name != created.Name || got.Version != 1 {
+		t.Errorf("glam = %+v, want the style created through the API", got)
+	}
+
+	// Seeding the same definitions again changes nothing
+	result, err = repo.Seed(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SeedResult{Diverged: []string{"bridal", "glam"}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("second seed result = %+v, want %+v", result, want)
+	}
+	if got := stored(t, repo)["natural"]; got.Version != 2 {
+		t.Errorf("natural re-seeded to v%d, want it left at v2", got.Version)
+	}
+}
+
+func TestStyleRepositorySeedUnrecordedStyles(t *testing.T) {
+	repo := newTestStyleRepository(t)
+
+	// Styles stored before seeds were recorded
+	err := repo.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stylesBucket)
+		untouched := style("natural", "Natural")
+		untouched.Version = 1
+		edited := style("bridal", "Bridal edited")
+		edited.Version = 3
+		for _, s := range []models.MakeupStyle{untouched, edited} {
+			if err := putStyle(bucket, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural v2"), style("bridal", "Bridal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SeedResult{Updated: []string{"natural"}, Diverged: []string{"bridal"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("seed result = %+v, want %+v", result, want)
+	}
+	if got := stored(t, repo)["bridal"]; got.Name != "Bridal edited" {
+		t.Errorf("bridal = %q, want the edit kept", got.Name)
+	}
+}
+
+func TestStyleRepositoryCreate(t *testing.T) {
+	repo := newTestStyleRepository(t)
+
+	created, err := repo.Create(models.MakeupStyle{ID: "glam", Name: "Glam", Version: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Version != 1 {
+		t.Errorf("created at version %d, want 1", created.Version)
+	}
+
+	if _, err := repo.Create(style("glam", "Again")); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("duplicate create: error = %v, want ErrAlreadyExists", err)
+	}
+}
+
+func TestStyleRepositoryDeleteAndRestore(t *testing.T) {
+	repo := newTestStyleRepository(t)
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Delete("natural", 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale delete: error = %v, want ErrVersionConflict", err)
+	}
+	if err := repo.Delete("missing", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete of unknown style: error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Delete("natural", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("natural", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete: error = %v, want ErrNotFound", err)
+	}
+
+	// Creating the style again restores it and clears the tombstone, so
+	// seeding leaves the restored version alone
+	restored, err := repo.Create(style("natural", "Restored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != 1 {
+		t.Errorf("restored at version %d, want 1", restored.Version)
+	}
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(t, repo)["natural"]; got.Name != "Restored" {
+		t.Errorf("natural = %q after re-seed, want the restored style", got.Name)
+	}
+
+	// Deleting the restored style tombstones it again
+	if err := repo.Delete("natural", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored(t, repo)["natural"]; ok {
+		t.Error("re-seeding restored a deleted style")
+	}
+}
+
+func TestStyleRepositoryUpdateVersions(t *testing.T) {
+	repo := newTestStyleRepository(t)
+	if _, err := repo.Seed([]models.MakeupStyle{style("natural", "Natural")}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := style("natural", "First")
+	first.Version = 1
+	updated, err := repo.Update(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("updated to version %d, want 2", updated.Version)
+	}
+
+	// A second writer still holding version 1 loses
+	second := style("natural", "Second")
+	second.Version = 1
+	if _, err := repo.Update(second); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale update: error = %v, want ErrVersionConflict", err)
+	}
+	if got := stored(t, repo)["natural"]; got.Name != "First" || got.Version != 2 {
+		t.Errorf("natural = %q v%d, want First v2", got.Name, got.Version)
+	}
+
+	// Versions ahead of the stored one are conflicts too
+	ahead := style("natural", "Ahead")
+	ahead.Version = 5
+	if _, err := repo.Update(ahead); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("future version: error = %v, want ErrVersionConflict", err)
+	}
+
+	missing := style("missing", "Missing")
+	missing.Version = 1
+	if _, err := repo.Update(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of unknown style: error = %v, want ErrNotFound", err)
+	}
+}
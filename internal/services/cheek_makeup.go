@@ -0,0 +1,197 @@
+package services
+
+import (
+	"image"
+	"makeup-api/internal/models"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// softSpot is an elliptical Gaussian falloff: full strength at the centre,
+// about 14% at the radii and cut off at one and a half times them.
+type softSpot struct {
+	center image.Point
+	rx, ry float64
+	angle  float64 // radians, rotation of the rx axis from horizontal
+}
+
+func (s softSpot) bounds() image.Rectangle {
+	r := int(math.Max(s.rx, s.ry)*1.5) + 1
+	return image.Rect(s.center.X-r, s.center.Y-r, s.center.X+r, s.center.Y+r)
+}
+
+func (s softSpot) weight(x, y int) float64 {
+	dx, dy := float64(x-s.center.X), float64(y-s.center.Y)
+	cos, sin := math.Cos(s.angle), math.Sin(s.angle)
+	u := (dx*cos + dy*sin) / s.rx
+	v := (-dx*sin + dy*cos) / s.ry
+	d := u*u + v*v
+	if d > 2.25 {
+		return 0
+	}
+	return math.Exp(-2 * d)
+}
+
+// spotRegion rasterises soft spots into a region mask. Pixels outside clip
+// (when given) or inside holes are left out, so colour never lands on the
+// eyes, lips or background.
+func spotRegion(img gocv.Mat, lm FaceLandmarks, spots []softSpot, clip []image.Point, holes [][]image.Point) (*regionMask, bool) {
+	var bounds image.Rectangle
+	for _, spot := range spots {
+		bounds = bounds.Union(spot.bounds())
+	}
+	rect := bounds.Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil, false
+	}
+
+	mask := gocv.NewMatWithSize(rect.Dy(), rect.Dx(), gocv.MatTypeCV8UC1)
+	weights, err := mask.DataPtrUint8()
+	if err != nil {
+		mask.Close()
+		return nil, false
+	}
+
+	width := rect.Dx()
+	for i := range weights {
+		x, y := rect.Min.X+i%width, rect.Min.Y+i/width
+		w := 0.0
+		for _, spot := range spots {
+			w = math.Max(w, spot.weight(x, y))
+		}
+		weights[i] = clampUint8(w * 255)
+	}
+
+	if clip != nil {
+		allowed := polygonMask(rect, [][]image.Point{clip}, holes)
+		defer allowed.Close()
+		featherMask(&allowed, featherRadius(lm, 0.02))
+		if allowedWeights, err := allowed.DataPtrUint8(); err == nil {
+			for i := range weights {
+				weights[i] = uint8(int(weights[i]) * int(allowedWeights[i]) / 255)
+			}
+		}
+	}
+
+	return &regionMask{rect: rect, mask: mask}, true
+}
+
+// faceWidth is the distance between the ends of the jawline
+func faceWidth(lm FaceLandmarks) float64 {
+	return distance(lm.Points[0], lm.Points[16])
+}
+
+// cheekApples locates the apples of the cheeks: below the centre of each
+// eye, a little above the level of the nostrils.
+func cheekApples(lm FaceLandmarks) []image.Point {
+	noseY := lm.Points[33].Y
+	apples := make([]image.Point, 0, 2)
+	for _, eye := range [][]image.Point{lm.RightEye(), lm.LeftEye()} {
+		center := centroid(eye)
+		apples = append(apples, image.Pt(center.X, noseY-(noseY-center.Y)/5))
+	}
+	return apples
+}
+
+// renderBlush places soft radial flushes on the apples of the cheeks,
+// swept slightly up towards the temples.
+func (ms *MakeupService) renderBlush(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	r := paramFloat(layer, "radius", 0.12) * faceWidth(lm)
+
+	apples := cheekApples(lm)
+	temples := []image.Point{lm.Points[0], lm.Points[16]}
+	spots := make([]softSpot, len(apples))
+	for i, apple := range apples {
+		// Stretch each flush along the line from the apple to its temple
+		toTemple := temples[i].Sub(apple)
+		spots[i] = softSpot{
+			center: apple,
+			rx:     r * 1.3,
+			ry:     r * 0.9,
+			angle:  math.Atan2(float64(toTemple.Y), float64(toTemple.X)),
+		}
+	}
+
+	region, ok := spotRegion(*img, lm, spots, lm.FaceOutline(), featureHoles(lm))
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	blendColor(overlay, shade, blendMode(layer))
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
+
+// renderHighlighter brightens the cheekbones, nose bridge and cupid's bow
+// (or just the layer's region), by default with a screen blend, which lifts
+// shadows more than already bright skin.
+func (ms *MakeupService) renderHighlighter(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	r := paramFloat(layer, "radius", 0.07) * faceWidth(lm)
+
+	areas := []string{models.HighlightCheekbones, models.HighlightNoseBridge, models.HighlightCupidsBow}
+	if layer.Region != "" {
+		areas = []string{layer.Region}
+	}
+
+	var spots []softSpot
+	for _, area := range areas {
+		switch area {
+		case models.HighlightCheekbones:
+			// Between the apples and the outer eye corners, stretched
+			// along the cheekbone towards the temples
+			corners := []image.Point{lm.Points[36], lm.Points[45]}
+			temples := []image.Point{lm.Points[0], lm.Points[16]}
+			for i, apple := range cheekApples(lm) {
+				along := temples[i].Sub(apple)
+				spots = append(spots, softSpot{
+					center: image.Pt((apple.X+corners[i].X)/2, (apple.Y+corners[i].Y)/2),
+					rx:     r * 1.4,
+					ry:     r * 0.5,
+					angle:  math.Atan2(float64(along.Y), float64(along.X)),
+				})
+			}
+		case models.HighlightNoseBridge:
+			// A thin vertical streak down the bridge
+			top, tip := lm.Points[27], lm.Points[30]
+			spots = append(spots, softSpot{
+				center: image.Pt((top.X+tip.X)/2, (top.Y+tip.Y)/2),
+				rx:     r * 0.3,
+				ry:     distance(top, tip) / 2,
+				angle:  math.Atan2(float64(tip.Y-top.Y), float64(tip.X-top.X)) - math.Pi/2,
+			})
+		case models.HighlightCupidsBow:
+			// Just above the dip of the upper lip
+			bow := lm.Points[51]
+			spots = append(spots, softSpot{
+				center: image.Pt(bow.X, bow.Y-int(r*0.4)),
+				rx:     r * 0.5,
+				ry:     r * 0.25,
+			})
+		}
+	}
+	if len(spots) == 0 {
+		return
+	}
+
+	region, ok := spotRegion(*img, lm, spots, lm.FaceOutline(), featureHoles(lm))
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	blendColor(overlay, shade, blendMode(layer))
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
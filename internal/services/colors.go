@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"image/color"
+	"makeup-api/internal/models"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// labColor is a colour in OpenCV's 8-bit Lab encoding: L scaled to 0-255,
+// a and b offset by 128
+type labColor struct {
+	L, A, B float64
+}
+
+// parseHexColor parses #RGB or #RRGGBB
+func parseHexColor(hex string) (color.RGBA, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q (want #RRGGBB)", hex)
+	}
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q (want #RRGGBB)", hex)
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+}
+
+// toLab converts an RGB colour with the same conversion used for images
+func toLab(c color.RGBA) labColor {
+	pixel := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(c.B), float64(c.G), float64(c.R), 0), 1, 1, gocv.MatTypeCV8UC3)
+	defer pixel.Close()
+	gocv.CvtColor(pixel, &pixel, gocv.ColorBGRToLab)
+
+	lab, err := pixel.DataPtrUint8()
+	if err != nil {
+		return labColor{}
+	}
+	return labColor{L: float64(lab[0]), A: float64(lab[1]), B: float64(lab[2])}
+}
+
+// fromLab converts an 8-bit Lab colour back to RGB
+func fromLab(c labColor) color.RGBA {
+	pixel := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(c.L, c.A, c.B, 0), 1, 1, gocv.MatTypeCV8UC3)
+	defer pixel.Close()
+	gocv.CvtColor(pixel, &pixel, gocv.ColorLabToBGR)
+
+	bgr, err := pixel.DataPtrUint8()
+	if err != nil {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: bgr[2], G: bgr[1], B: bgr[0], A: 255}
+}
+
+// toHex formats a colour as #RRGGBB
+func toHex(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// meanLab averages the Lab pixels of a rect-sized image where the mask is
+// at least half on.
+func meanLab(lab []uint8, mask []uint8) (labColor, bool) {
+	var sum labColor
+	var n float64
+	for i, weight := range mask {
+		if weight < 128 {
+			continue
+		}
+		sum.L += float64(lab[i*3])
+		sum.A += float64(lab[i*3+1])
+		sum.B += float64(lab[i*3+2])
+		n++
+	}
+	if n == 0 {
+		return labColor{}, false
+	}
+	return labColor{L: sum.L / n, A: sum.A / n, B: sum.B / n}, true
+}
+
+// pixelNoise is a deterministic per-pixel value in [0, 1), so textured
+// effects render identically for the same image.
+func pixelNoise(x, y int) float64 {
+	h := uint32(x)*374761393 + uint32(y)*668265263
+	h = (h ^ (h >> 13)) * 1274126177
+	return float64(h^(h>>16)) / float64(1<<32)
+}
+
+// blendChannel composites one 8-bit channel of top over base with a blend
+// mode; unknown modes behave as normal.
+func blendChannel(mode string, base, top uint8) uint8 {
+	b, t := int(base), int(top)
+	switch mode {
+	case models.BlendMultiply:
+		return uint8(b * t / 255)
+	case models.BlendScreen:
+		return uint8(255 - (255-b)*(255-t)/255)
+	case models.BlendOverlay:
+		if b < 128 {
+			return uint8(2 * b * t / 255)
+		}
+		return uint8(255 - 2*(255-b)*(255-t)/255)
+	case models.BlendSoftLight:
+		return uint8(((255-2*t)*b*b/255 + 2*t*b) / 255)
+	default:
+		return top
+	}
+}
+
+// blendColor composites c onto a continuous BGR mat in place
+func blendColor(mat gocv.Mat, c color.RGBA, mode string) {
+	pixels, err := mat.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	channels := [3]uint8{c.B, c.G, c.R}
+	for i := range pixels {
+		pixels[i] = blendChannel(mode, pixels[i], channels[i%3])
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"image"
+	"makeup-api/internal/models"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// defaultContourColor is a cool taupe that reads as shadow on most skin
+const defaultContourColor = "#8C6E64"
+
+// faceProportions are the landmark measurements face shapes are judged by
+type faceProportions struct {
+	length     float64 // estimated hairline to chin
+	cheekbones float64 // width across the cheekbones
+	jaw        float64 // width across the lower jaw
+	forehead   float64 // width across the outer brow ends
+}
+
+func measureFace(lm FaceLandmarks) faceProportions {
+	outline := lm.FaceOutline()
+	top := outline[len(outline)-1]
+	for _, p := range outline[17:] {
+		if p.Y < top.Y {
+			top = p
+		}
+	}
+	return faceProportions{
+		length:     float64(lm.Points[8].Y - top.Y),
+		cheekbones: distance(lm.Points[1], lm.Points[15]),
+		jaw:        distance(lm.Points[4], lm.Points[12]),
+		forehead:   distance(lm.Points[17], lm.Points[26]),
+	}
+}
+
+// classifyFaceShape sorts a face into one of the classic shapes from the
+// ratio of its length to width and how the jaw and forehead compare with
+// the cheekbones.
+func classifyFaceShape(lm FaceLandmarks) string {
+	p := measureFace(lm)
+	if p.cheekbones == 0 || p.jaw == 0 {
+		return models.FaceShapeOval
+	}
+
+	elongation := p.length / p.cheekbones
+	jawRatio := p.jaw / p.cheekbones
+
+	switch {
+	case elongation > 1.45:
+		return models.FaceShapeLong
+	case p.forehead/p.jaw > 1.25:
+		return models.FaceShapeHeart
+	case jawRatio > 0.82 && elongation < 1.35:
+		return models.FaceShapeSquare
+	case elongation < 1.1:
+		return models.FaceShapeRound
+	default:
+		return models.FaceShapeOval
+	}
+}
+
+// contourZone is a group of spots shaded at a fraction of the layer intensity
+type contourZone struct {
+	spots    []softSpot
+	strength float64
+}
+
+// contourZones places shade for a face shape. Every shape gets the hollows
+// under the cheekbones; the rest slims whatever the shape has too much of.
+func contourZones(lm FaceLandmarks, shape string) []contourZone {
+	r := faceWidth(lm) * 0.08
+	p := lm.Points
+
+	// Hollows: from just below the ear towards the mouth corner
+	var hollows []softSpot
+	for _, side := range [][2]int{{2, 48}, {14, 54}} {
+		ear, mouth := p[side[0]], p[side[1]]
+		along := mouth.Sub(ear)
+		hollows = append(hollows, softSpot{
+			center: image.Pt(ear.X+along.X*3/10, ear.Y+along.Y*3/10),
+			rx:     distance(ear, mouth) * 0.3,
+			ry:     r * 0.45,
+			angle:  math.Atan2(float64(along.Y), float64(along.X)),
+		})
+	}
+
+	// Temples: outside the brows, level with their highest point
+	browLift := p[27].Y - (p[19].Y+p[24].Y)/2
+	var temples []softSpot
+	for _, end := range []image.Point{p[0], p[16]} {
+		temples = append(temples, softSpot{
+			center: image.Pt(end.X+(p[27].X-end.X)/8, end.Y-browLift*2),
+			rx:     r * 0.7,
+			ry:     r * 1.1,
+		})
+	}
+
+	// Jaw: along the lower jawline on both sides
+	var jaw []softSpot
+	for _, pair := range [][2]int{{3, 5}, {13, 11}} {
+		from, to := p[pair[0]], p[pair[1]]
+		along := to.Sub(from)
+		jaw = append(jaw, softSpot{
+			center: image.Pt((from.X+to.X)/2, (from.Y+to.Y)/2),
+			rx:     distance(from, to) * 0.7,
+			ry:     r * 0.5,
+			angle:  math.Atan2(float64(along.Y), float64(along.X)),
+		})
+	}
+
+	// Jaw corners, for squaring off
+	corners := []softSpot{
+		{center: p[4], rx: r * 0.8, ry: r * 0.8},
+		{center: p[12], rx: r * 0.8, ry: r * 0.8},
+	}
+
+	// Hairline and chin tip, for shortening
+	outline := lm.FaceOutline()
+	hairline := outline[len(outline)-5]
+	ends := []softSpot{
+		{center: image.Pt(p[27].X, hairline.Y), rx: r * 2.5, ry: r * 0.7},
+		{center: p[8], rx: r * 1.2, ry: r * 0.5},
+	}
+
+	switch shape {
+	case models.FaceShapeRound:
+		// Slim the sides and lengthen the hollows
+		return []contourZone{{hollows, 1}, {temples, 0.6}, {jaw, 0.7}}
+	case models.FaceShapeSquare:
+		// Soften the strong jaw corners
+		return []contourZone{{hollows, 0.8}, {corners, 1}, {temples, 0.6}}
+	case models.FaceShapeHeart:
+		// Narrow the wide forehead, leave the slim jaw alone
+		return []contourZone{{hollows, 0.7}, {temples, 1}}
+	case models.FaceShapeLong:
+		// Shorten from the hairline and chin
+		return []contourZone{{hollows, 0.5}, {ends, 0.9}}
+	default:
+		return []contourZone{{hollows, 1}, {temples, 0.3}, {jaw, 0.3}}
+	}
+}
+
+// renderContour shades the zones for the face's shape, by default
+// multiplying the shade into the skin so texture is kept.
+func (ms *MakeupService) renderContour(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	hex := layer.Color
+	if hex == "" {
+		hex = defaultContourColor
+	}
+	shade, err := parseHexColor(hex)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	mode := blendMode(layer)
+
+	for _, zone := range contourZones(lm, classifyFaceShape(lm)) {
+		region, ok := spotRegion(*img, lm, zone.spots, lm.FaceOutline(), featureHoles(lm))
+		if !ok {
+			continue
+		}
+
+		overlay := region.source(*img)
+		blendColor(overlay, shade, mode)
+		region.blend(img, overlay, clamp01(layer.Opacity*zone.strength))
+
+		overlay.Close()
+		region.Close()
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"makeup-api/internal/models"
+
+	"gocv.io/x/gocv"
+)
+
+// eyeShape describes one eye from its outer corner inwards, so both eyes
+// can be drawn by the same code.
+type eyeShape struct {
+	outer, inner image.Point
+	upper        []image.Point // upper lash line, outer corner to inner corner
+	lower        []image.Point // lower lash line, inner corner to outer corner
+	brow         []image.Point // outer end to inner end
+}
+
+func eyeShapes(lm FaceLandmarks) []eyeShape {
+	return []eyeShape{
+		{
+			outer: lm.Points[36], inner: lm.Points[39],
+			upper: lm.pick(36, 37, 38, 39),
+			lower: lm.pick(39, 40, 41, 36),
+			brow:  lm.pick(17, 18, 19, 20, 21),
+		},
+		{
+			outer: lm.Points[45], inner: lm.Points[42],
+			upper: lm.pick(45, 44, 43, 42),
+			lower: lm.pick(42, 47, 46, 45),
+			brow:  lm.pick(26, 25, 24, 23, 22),
+		},
+	}
+}
+
+func (e eyeShape) width() float64 {
+	return distance(e.outer, e.inner)
+}
+
+// opening is the visible eyeball, which no eye layer may paint over
+func (e eyeShape) opening() []image.Point {
+	return append(append([]image.Point(nil), e.upper...), e.lower[1:len(e.lower)-1]...)
+}
+
+// renderEyeshadow shades the lid up to two thirds of the way to the brow.
+// The colour runs from the lid colour at the lash line to the crease colour
+// higher up and fades out towards the brow bone. By default it is
+// multiplied into the skin so lid texture shows through.
+func renderEyeshadow(img *gocv.Mat, lm FaceLandmarks, eye eyeShape, layer models.EffectLayer) {
+	lid, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	crease := lid
+	if parsed, err := parseHexColor(paramString(layer, "crease_color", "")); err == nil {
+		crease = parsed
+	}
+	mode := blendMode(layer)
+
+	area := append([]image.Point(nil), eye.upper...)
+	top := 0
+	for i := len(eye.brow) - 1; i >= 0; i-- {
+		p := eye.brow[i]
+		lowered := image.Pt(p.X, p.Y+(eye.outer.Y-p.Y)/3)
+		area = append(area, lowered)
+		top += lowered.Y
+	}
+	top /= len(eye.brow)
+
+	region, ok := newRegionMask(*img, [][]image.Point{area}, [][]image.Point{eye.opening()}, featherRadius(lm, 0.02))
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	pixels, err := overlay.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	weights, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return
+	}
+
+	lash := polygonBounds(eye.upper).Max.Y
+	width := region.rect.Dx()
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		y := region.rect.Min.Y + i/width
+		t := 0.0
+		if lash > top {
+			t = clamp01(float64(lash-y) / float64(lash-top))
+		}
+		shade := mixColor(lid, crease, t)
+		pixels[i*3] = blendChannel(mode, pixels[i*3], shade.B)
+		pixels[i*3+1] = blendChannel(mode, pixels[i*3+1], shade.G)
+		pixels[i*3+2] = blendChannel(mode, pixels[i*3+2], shade.R)
+		weights[i] = clampUint8(float64(weight) * (1 - 0.6*t))
+	}
+
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
+
+// renderEyeliner strokes the upper lash line, tapering from the outer
+// corner to the inner corner, with an optional wing flicked outwards.
+func renderEyeliner(img *gocv.Mat, eye eyeShape, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	thickness := paramFloat(layer, "thickness", 0.06)
+	px := int(eye.width()*thickness + 0.5)
+	if px < 1 {
+		px = 1
+	}
+
+	// Sit the stroke on top of the lash line rather than over the eye
+	lift := image.Pt(0, -px/2)
+	stroke := make([]image.Point, len(eye.upper))
+	for i, p := range eye.upper {
+		stroke[i] = p.Add(lift)
+	}
+
+	var wing []image.Point
+	if paramBool(layer, "wing", false) {
+		out := eye.outer.Sub(eye.inner)
+		tip := eye.outer.Add(image.Pt(out.X*3/10, -int(eye.width()*0.15)))
+		wing = []image.Point{eye.outer.Add(image.Pt(0, -px)), tip, eye.outer.Add(image.Pt(0, px/2))}
+	}
+
+	rect := polygonBounds(append(append([]image.Point(nil), stroke...), wing...)).Inset(-2 * px).
+		Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return
+	}
+
+	mask := gocv.NewMatWithSize(rect.Dy(), rect.Dx(), gocv.MatTypeCV8UC1)
+	mask.SetTo(gocv.NewScalar(0, 0, 0, 0))
+	white := color.RGBA{255, 255, 255, 255}
+	for i := 0; i+1 < len(stroke); i++ {
+		taper := 1 - 0.6*float64(i)/float64(len(stroke)-1)
+		width := int(float64(px)*taper + 0.5)
+		if width < 1 {
+			width = 1
+		}
+		gocv.Line(&mask, stroke[i].Sub(rect.Min), stroke[i+1].Sub(rect.Min), white, width)
+	}
+	if wing != nil {
+		fillPolygons(&mask, [][]image.Point{wing}, rect.Min, white)
+	}
+	featherMask(&mask, 1)
+
+	region := &regionMask{rect: rect, mask: mask}
+	defer region.Close()
+
+	overlay := region.solid(shade)
+	defer overlay.Close()
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
+
+// renderMascara darkens a band of lashes above the upper lash line and,
+// more lightly, below the lower one. Pixels that are already dark (the
+// lashes themselves) take the most colour, and a per-column variation keeps
+// the result looking like separate strands.
+func renderMascara(img *gocv.Mat, lm FaceLandmarks, eye eyeShape, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+
+	length := int(eye.width() * 0.12)
+	if length < 2 {
+		length = 2
+	}
+	darkenLashes(img, lm, lashBand(eye.upper, -length), shade, layer.Opacity)
+	darkenLashes(img, lm, lashBand(eye.lower, length/2), shade, layer.Opacity*0.5)
+}
+
+// lashBand extends a lash line by offset pixels vertically into a polygon
+func lashBand(line []image.Point, offset int) []image.Point {
+	band := append([]image.Point(nil), line...)
+	for i := len(line) - 1; i >= 0; i-- {
+		band = append(band, line[i].Add(image.Pt(0, offset)))
+	}
+	return band
+}
+
+func darkenLashes(img *gocv.Mat, lm FaceLandmarks, band []image.Point, shade color.RGBA, intensity float64) {
+	region, ok := newRegionMask(*img, [][]image.Point{band}, nil, featherRadius(lm, 0.005))
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	source := region.source(*img)
+	defer source.Close()
+	pixels, err := source.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	weights, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return
+	}
+
+	width := region.rect.Dx()
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		luma := (float64(pixels[i*3]) + float64(pixels[i*3+1]) + float64(pixels[i*3+2])) / 3
+		strand := 0.6 + 0.4*pixelNoise(region.rect.Min.X+i%width, 0)
+		weights[i] = clampUint8(float64(weight) * (1 - luma/255) * strand)
+	}
+
+	overlay := region.solid(shade)
+	defer overlay.Close()
+	region.blend(img, overlay, clamp01(intensity))
+}
+
+// mixColor interpolates from a to b
+func mixColor(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return clampUint8(float64(x) + (float64(y)-float64(x))*t)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"makeup-api/internal/models"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// AnalyzeFaces runs the same detection as ApplyMakeupStyle and reports each
+// face with its landmarks, quality measurements and quality issues, without
+// editing the image. Landmarks are omitted where landmark detection fails.
+func (ms *MakeupService) AnalyzeFaces(imagePath string) (models.FaceDetectionResult, error) {
+	result := models.FaceDetectionResult{DefaultFace: -1}
+
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return result, fmt.Errorf("failed to load image: %s", imagePath)
+	}
+	defer img.Close()
+
+	result.Width, result.Height = img.Cols(), img.Rows()
+
+	faces, err := ms.detectFaces(img)
+	if err != nil {
+		return result, err
+	}
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+
+	result.Faces = make([]models.FaceAnalysis, len(faces))
+	for i, face := range faces {
+		result.Faces[i] = ms.analyzeFace(img, gray, i, ms.measureFace(img, face))
+	}
+
+	if len(faces) > 0 {
+		selected, _ := selectFaces(faces, FaceSelection{Mode: FaceSelectLargest})
+		result.DefaultFace = selected[0]
+	}
+	return result, nil
+}
+
+// faceMeasurement is the landmarks and complexion of one face, found once
+// and shared by the quality check and the renderer
+type faceMeasurement struct {
+	box       image.Rectangle
+	landmarks *FaceLandmarks // nil when landmark detection failed
+	err       error          // why landmark detection failed
+	skin      labColor
+	skinFound bool
+}
+
+// measureFace locates the features of a face and measures its complexion
+func (ms *MakeupService) measureFace(img gocv.Mat, face image.Rectangle) faceMeasurement {
+	m := faceMeasurement{box: face}
+	lm, err := ms.landmarks.Detect(img, face)
+	if err != nil {
+		m.err = err
+		return m
+	}
+	m.landmarks = &lm
+	m.skin, m.skinFound = measureSkinTone(img, lm)
+	return m
+}
+
+// measureFaces measures the selected faces, in the order of selected, before
+// anything is drawn on the image
+func (ms *MakeupService) measureFaces(img gocv.Mat, faces []image.Rectangle, selected []int) []faceMeasurement {
+	measured := make([]faceMeasurement, len(selected))
+	for i, index := range selected {
+		measured[i] = ms.measureFace(img, faces[index])
+	}
+	return measured
+}
+
+// analyzeFace evaluates a measured face against the quality thresholds.
+// Landmarks are left empty when landmark detection failed.
+func (ms *MakeupService) analyzeFace(img, gray gocv.Mat, index int, m faceMeasurement) models.FaceAnalysis {
+	analysis := models.FaceAnalysis{Index: index, Box: toFaceBox(m.box)}
+
+	if lm := m.landmarks; lm != nil {
+		analysis.Landmarks = toPoints(lm.Points)
+		analysis.LandmarksEstimated = lm.Estimated
+		analysis.Shape = classifyFaceShape(*lm)
+		if m.skinFound {
+			tone := describeSkinTone(m.skin)
+			analysis.SkinTone = &tone
+		}
+	}
+
+	analysis.Quality = measureFaceQuality(img, gray, m.box, m.landmarks)
+	analysis.Issues = ms.quality.evaluate(index, m.box, image.Rect(0, 0, img.Cols(), img.Rows()), analysis.Quality)
+	return analysis
+}
+
+// measureFaceQuality computes sharpness, exposure, relative size, skin
+// coverage and, with measured landmarks, head pose over a face.
+func measureFaceQuality(img, gray gocv.Mat, face image.Rectangle, lm *FaceLandmarks) models.FaceQuality {
+	frame := image.Rect(0, 0, gray.Cols(), gray.Rows())
+	rect := face.Intersect(frame)
+	if rect.Empty() {
+		return models.FaceQuality{}
+	}
+
+	roi := gray.Region(rect)
+	defer roi.Close()
+
+	mean := gocv.NewMat()
+	defer mean.Close()
+	stdDev := gocv.NewMat()
+	defer stdDev.Close()
+
+	quality := models.FaceQuality{
+		FaceRatio: float64(area(rect)) / float64(area(frame)),
+	}
+
+	gocv.MeanStdDev(roi, &mean, &stdDev)
+	quality.Brightness = mean.GetDoubleAt(0, 0)
+	quality.Contrast = stdDev.GetDoubleAt(0, 0)
+	quality.ShadowClip, quality.HighlightClip = clippedFractions(roi)
+
+	// Sharp edges give a wide spread of second derivatives
+	laplacian := gocv.NewMat()
+	defer laplacian.Close()
+	gocv.Laplacian(roi, &laplacian, gocv.MatTypeCV64F, 1, 1, 0, gocv.BorderDefault)
+	gocv.MeanStdDev(laplacian, &mean, &stdDev)
+	sd := stdDev.GetDoubleAt(0, 0)
+	quality.Sharpness = sd * sd
+
+	if lm != nil {
+		quality.SkinCoverage = skinCoverage(img, *lm)
+		if !lm.Estimated {
+			pose := estimateHeadPose(*lm)
+			quality.Pose = &pose
+		}
+	}
+
+	return quality
+}
+
+// clippedFractions reads the luma histogram of a face for the share of
+// pixels crushed into the shadows or blown out in the highlights.
+func clippedFractions(gray gocv.Mat) (shadows, highlights float64) {
+	hist := gocv.NewMat()
+	defer hist.Close()
+	mask := gocv.NewMat()
+	defer mask.Close()
+	gocv.CalcHist([]gocv.Mat{gray}, []int{0}, mask, &hist, []int{256}, []float64{0, 256}, false)
+
+	total := float64(gray.Rows() * gray.Cols())
+	if total == 0 {
+		return 0, 0
+	}
+	for i := 0; i < 256; i++ {
+		count := float64(hist.GetFloatAt(i, 0))
+		switch {
+		case i <= 15:
+			shadows += count
+		case i >= 240:
+			highlights += count
+		}
+	}
+	return shadows / total, highlights / total
+}
+
+// skinCoverage is the fraction of the inner face (outline minus eyes, brows
+// and lips) whose colour falls in the YCrCb skin range. Hands, hair, masks
+// or sunglasses over the face lower it.
+func skinCoverage(img gocv.Mat, lm FaceLandmarks) float64 {
+	region, ok := newRegionMask(img, [][]image.Point{lm.FaceOutline()}, featureHoles(lm), 1)
+	if !ok {
+		return 0
+	}
+	defer region.Close()
+
+	source := region.source(img)
+	defer source.Close()
+	ycrcb := gocv.NewMat()
+	defer ycrcb.Close()
+	gocv.CvtColor(source, &ycrcb, gocv.ColorBGRToYCrCb)
+
+	skin := gocv.NewMat()
+	defer skin.Close()
+	gocv.InRangeWithScalar(ycrcb, skinLower, skinUpper, &skin)
+
+	inside, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return 0
+	}
+	isSkin, err := skin.DataPtrUint8()
+	if err != nil {
+		return 0
+	}
+
+	var total, covered int
+	for i, weight := range inside {
+		if weight < 128 {
+			continue
+		}
+		total++
+		if isSkin[i] > 0 {
+			covered++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(covered) / float64(total)
+}
+
+// neutralPitchRatio is the eyes-to-nose-tip distance over the eyes-to-chin
+// distance on a face looking straight at the camera
+const neutralPitchRatio = 0.37
+
+// estimateHeadPose approximates head orientation from landmark geometry:
+// roll from the eye line, yaw from how far the nose tip sits towards one
+// side of the jaw, and pitch from where the nose tip falls between the eyes
+// and the chin.
+func estimateHeadPose(lm FaceLandmarks) models.HeadPose {
+	rightEye := centroid(lm.RightEye())
+	leftEye := centroid(lm.LeftEye())
+	eyeMid := image.Pt((rightEye.X+leftEye.X)/2, (rightEye.Y+leftEye.Y)/2)
+	nose := lm.Points[30]
+	chin := lm.Points[8]
+
+	roll := math.Atan2(float64(leftEye.Y-rightEye.Y), float64(leftEye.X-rightEye.X))
+
+	toRight := distance(nose, lm.Points[0])
+	toLeft := distance(nose, lm.Points[16])
+	var yaw float64
+	if toRight+toLeft > 0 {
+		yaw = math.Asin(clampUnit((toLeft - toRight) / (toRight + toLeft)))
+	}
+
+	var pitch float64
+	if faceHeight := distance(eyeMid, chin); faceHeight > 0 {
+		ratio := distance(eyeMid, nose) / faceHeight
+		pitch = math.Asin(clampUnit((ratio - neutralPitchRatio) / neutralPitchRatio))
+	}
+
+	return models.HeadPose{
+		Yaw:   degrees(yaw),
+		Pitch: degrees(pitch),
+		Roll:  degrees(roll),
+	}
+}
+
+func centroid(points []image.Point) image.Point {
+	var sum image.Point
+	for _, p := range points {
+		sum = sum.Add(p)
+	}
+	return sum.Div(len(points))
+}
+
+func distance(a, b image.Point) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(-1, math.Min(1, v))
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+func toPoints(points []image.Point) []models.Point {
+	converted := make([]models.Point, len(points))
+	for i, p := range points {
+		converted[i] = models.Point{X: p.X, Y: p.Y}
+	}
+	return converted
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Face detector backends selectable through FaceDetectorConfig
+const (
+	FaceDetectorHaar = "haar"
+	FaceDetectorDNN  = "dnn"
+)
+
+// FaceDetector finds face bounding boxes in a BGR image. Implementations
+// must be safe for concurrent use.
+type FaceDetector interface {
+	Detect(img gocv.Mat) ([]image.Rectangle, error)
+	Status() DetectorStatus
+}
+
+// FaceDetectorConfig selects and configures a FaceDetector
+type FaceDetectorConfig struct {
+	// Backend is haar (default) or dnn
+	Backend string
+	// CascadePath is the Haar cascade XML file
+	CascadePath string
+	// ModelPath and ConfigPath locate the DNN model. A Caffe model needs
+	// its .prototxt as ConfigPath; ONNX models need no config.
+	ModelPath  string
+	ConfigPath string
+	// MinConfidence discards weaker DNN detections; zero selects 0.5
+	MinConfidence float64
+	// PoolSize is the number of model instances loaded for concurrent use
+	PoolSize int
+}
+
+// NewFaceDetector builds and loads the detector chosen by config, failing
+// when the model files are missing or unreadable.
+func NewFaceDetector(config FaceDetectorConfig) (FaceDetector, error) {
+	switch strings.ToLower(strings.TrimSpace(config.Backend)) {
+	case "", FaceDetectorHaar:
+		return NewHaarFaceDetector(config.CascadePath, config.PoolSize)
+	case FaceDetectorDNN:
+		return NewDNNFaceDetector(config.ModelPath, config.ConfigPath, config.MinConfidence, config.PoolSize)
+	default:
+		return nil, fmt.Errorf("unknown face detector %q (want haar or dnn)", config.Backend)
+	}
+}
+
+// HaarFaceDetector detects frontal faces with an OpenCV Haar cascade
+type HaarFaceDetector struct {
+	cascades *modelPool[gocv.CascadeClassifier]
+}
+
+func NewHaarFaceDetector(cascadePath string, poolSize int) (*HaarFaceDetector, error) {
+	if cascadePath == "" {
+		cascadePath = "haarcascade_frontalface_alt.xml"
+	}
+	if _, err := os.Stat(cascadePath); err != nil {
+		return nil, fmt.Errorf("face cascade not found: %v", err)
+	}
+
+	cascades, err := newModelPool(poolSize, func() (gocv.CascadeClassifier, error) {
+		cascade := gocv.NewCascadeClassifier()
+		if !cascade.Load(cascadePath) {
+			cascade.Close()
+			return cascade, fmt.Errorf("failed to load face cascade classifier: %s", cascadePath)
+		}
+		return cascade, nil
+	}, func(cascade gocv.CascadeClassifier) { cascade.Close() })
+	if err != nil {
+		return nil, err
+	}
+	return &HaarFaceDetector{cascades: cascades}, nil
+}
+
+func (d *HaarFaceDetector) Detect(img gocv.Mat) ([]image.Rectangle, error) {
+	var faces []image.Rectangle
+	err := d.cascades.with(func(cascade gocv.CascadeClassifier) error {
+		faces = cascade.DetectMultiScale(img)
+		return nil
+	})
+	return faces, err
+}
+
+func (d *HaarFaceDetector) Status() DetectorStatus {
+	return d.cascades.status(FaceDetectorHaar)
+}
+
+// DNNFaceDetector runs an SSD-style face detector (for example OpenCV's
+// res10_300x300_ssd, as Caffe or an ONNX export) on the CPU. It handles
+// tilted and partly turned faces that the Haar cascade misses. Only models
+// whose output is SSD detection rows of shape [1, 1, N, 7] are supported.
+type DNNFaceDetector struct {
+	nets          *modelPool[gocv.Net]
+	minConfidence float64
+}
+
+func NewDNNFaceDetector(modelPath, configPath string, minConfidence float64, poolSize int) (*DNNFaceDetector, error) {
+	if modelPath == "" {
+		return nil, fmt.Errorf("dnn face detector needs a model path")
+	}
+
+	nets, err := newModelPool(poolSize, func() (gocv.Net, error) {
+		return loadNet(modelPath, configPath)
+	}, func(net gocv.Net) { net.Close() })
+	if err != nil {
+		return nil, fmt.Errorf("failed to load face model: %v", err)
+	}
+
+	if minConfidence <= 0 {
+		minConfidence = 0.5
+	}
+	return &DNNFaceDetector{nets: nets, minConfidence: minConfidence}, nil
+}
+
+func (d *DNNFaceDetector) Detect(img gocv.Mat) ([]image.Rectangle, error) {
+	// The SSD model expects a 300x300 BGR blob with the training mean removed
+	blob := gocv.BlobFromImage(img, 1.0, image.Pt(300, 300), gocv.NewScalar(104, 177, 123, 0), false, false)
+	defer blob.Close()
+
+	var values []float32
+	var shape []int
+	err := d.nets.with(func(net gocv.Net) error {
+		net.SetInput(blob, "")
+		output := net.Forward("")
+		defer output.Close()
+
+		shape = output.Size()
+		data, err := output.DataPtrFloat32()
+		if err != nil {
+			return fmt.Errorf("failed to read face detector output: %v", err)
+		}
+		// Copy out before the output mat is freed
+		values = append([]float32(nil), data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseSSDDetections(shape, values, img.Cols(), img.Rows(), d.minConfidence)
+}
+
+// parseSSDDetections reads the faces out of an SSD output of shape
+// [1, 1, N, 7]. Each detection is [image, class, confidence, left, top,
+// right, bottom] with coordinates normalised to the image. Other layouts
+// are rejected rather than misread.
+func parseSSDDetections(shape []int, values []float32, width, height int, minConfidence float64) ([]image.Rectangle, error) {
+	if len(shape) != 4 || shape[0] != 1 || shape[1] != 1 || shape[3] != 7 || len(values) != shape[2]*7 {
+		return nil, fmt.Errorf("unsupported face model output shape %v, want SSD detections [1 1 N 7]", shape)
+	}
+
+	frame := image.Rect(0, 0, width, height)
+	var faces []image.Rectangle
+	for i := 0; i+7 <= len(values); i += 7 {
+		if float64(values[i+2]) < minConfidence {
+			continue
+		}
+		face := image.Rect(
+			int(values[i+3]*float32(width)),
+			int(values[i+4]*float32(height)),
+			int(values[i+5]*float32(width)),
+			int(values[i+6]*float32(height)),
+		).Intersect(frame)
+		if !face.Empty() {
+			faces = append(faces, face)
+		}
+	}
+	return faces, nil
+}
+
+func (d *DNNFaceDetector) Status() DetectorStatus {
+	return d.nets.status(FaceDetectorDNN)
+}
+
+// loadNet reads a DNN model for CPU inference
+func loadNet(modelPath, configPath string) (gocv.Net, error) {
+	if _, err := os.Stat(modelPath); err != nil {
+		return gocv.Net{}, err
+	}
+	net := gocv.ReadNet(modelPath, configPath)
+	if net.Empty() {
+		net.Close()
+		return net, fmt.Errorf("failed to read model: %s", modelPath)
+	}
+	net.SetPreferableBackend(gocv.NetBackendOpenCV)
+	net.SetPreferableTarget(gocv.NetTargetCPU)
+	return net, nil
+}
+
+// FakeFaceDetector returns fixed results, for exercising MakeupService
+// without model files.
+type FakeFaceDetector struct {
+	Faces []image.Rectangle
+	Err   error
+}
+
+func (d *FakeFaceDetector) Detect(img gocv.Mat) ([]image.Rectangle, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	return append([]image.Rectangle(nil), d.Faces...), nil
+}
+
+func (d *FakeFaceDetector) Status() DetectorStatus {
+	return DetectorStatus{Backend: "fake"}
+}
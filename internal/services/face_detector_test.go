@@ -0,0 +1,49 @@
+package services
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestParseSSDDetections(t *testing.T) {
+	values := []float32{
+		0, 1, 0.9, 0.1, 0.2, 0.3, 0.6, // kept
+		0, 1, 0.3, 0.5, 0.5, 0.7, 0.7, // below confidence
+		0, 1, 0.8, 0.9, 0.9, 1.2, 1.1, // clipped to the frame
+		0, 1, 0.95, 1.1, 1.1, 1.3, 1.3, // entirely outside
+	}
+	faces, err := parseSSDDetections([]int{1, 1, 4, 7}, values, 200, 100, 0.5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []image.Rectangle{
+		image.Rect(20, 20, 60, 60),
+		image.Rect(180, 90, 200, 100),
+	}
+	if !reflect.DeepEqual(faces, want) {
+		t.Errorf("got %v, want %v", faces, want)
+	}
+}
+
+func TestParseSSDDetectionsRejectsOtherLayouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		shape  []int
+		values int
+	}{
+		{"yolo style", []int{1, 25200, 85}, 25200 * 85},
+		{"wrong row width", []int{1, 1, 10, 15}, 150},
+		{"batched", []int{2, 1, 10, 7}, 140},
+		{"size mismatch", []int{1, 1, 10, 7}, 63},
+		{"no shape", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSSDDetections(tt.shape, make([]float32, tt.values), 100, 100, 0.5); err == nil {
+				t.Errorf("shape %v was accepted", tt.shape)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"makeup-api/internal/models"
+	"sort"
+	"strings"
+)
+
+// Face selection modes accepted by apply requests
+const (
+	FaceSelectLargest = "largest"
+	FaceSelectAll     = "all"
+	FaceSelectIndex   = "index"
+	FaceSelectBox     = "box"
+)
+
+// ErrInvalidFaceSelection is returned for malformed face selection parameters
+var ErrInvalidFaceSelection = errors.New("invalid face selection")
+
+// FaceSelection chooses which detected faces receive makeup
+type FaceSelection struct {
+	Mode  string
+	Index int             // FaceSelectIndex only
+	Box   image.Rectangle // FaceSelectBox only
+}
+
+// ParseFaceSelection validates the face selection fields of an apply
+// request. An empty mode selects the largest face.
+func ParseFaceSelection(mode string, index *int, box *models.FaceBox) (FaceSelection, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", FaceSelectLargest:
+		return FaceSelection{Mode: FaceSelectLargest}, nil
+	case FaceSelectAll:
+		return FaceSelection{Mode: FaceSelectAll}, nil
+	case FaceSelectIndex:
+		if index == nil || *index < 0 {
+			return FaceSelection{}, fmt.Errorf("%w: face_index must be a non-negative integer", ErrInvalidFaceSelection)
+		}
+		return FaceSelection{Mode: FaceSelectIndex, Index: *index}, nil
+	case FaceSelectBox:
+		if box == nil || box.Width <= 0 || box.Height <= 0 {
+			return FaceSelection{}, fmt.Errorf("%w: face_box needs a positive width and height", ErrInvalidFaceSelection)
+		}
+		return FaceSelection{
+			Mode: FaceSelectBox,
+			Box:  image.Rect(box.X, box.Y, box.X+box.Width, box.Y+box.Height),
+		}, nil
+	default:
+		return FaceSelection{}, fmt.Errorf("%w: unknown mode %q (want largest, all, index or box)", ErrInvalidFaceSelection, mode)
+	}
+}
+
+// sortFaces orders faces left to right, then top to bottom, so face indexes
+// are stable for a given image regardless of detector output order.
+func sortFaces(faces []image.Rectangle) {
+	sort.SliceStable(faces, func(i, j int) bool {
+		if faces[i].Min.X != faces[j].Min.X {
+			return faces[i].Min.X < faces[j].Min.X
+		}
+		return faces[i].Min.Y < faces[j].Min.Y
+	})
+}
+
+// selectFaces returns the indexes of the faces chosen by sel
+func selectFaces(faces []image.Rectangle, sel FaceSelection) ([]int, error) {
+	switch sel.Mode {
+	case FaceSelectAll:
+		indexes := make([]int, len(faces))
+		for i := range faces {
+			indexes[i] = i
+		}
+		return indexes, nil
+
+	case FaceSelectIndex:
+		if sel.Index >= len(faces) {
+			return nil, fmt.Errorf("face index %d out of range (%d faces detected)", sel.Index, len(faces))
+		}
+		return []int{sel.Index}, nil
+
+	case FaceSelectBox:
+		// Pick the face that overlaps the requested box the most
+		best, bestOverlap := -1, 0.0
+		for i, face := range faces {
+			if overlap := intersectionOverUnion(face, sel.Box); overlap > bestOverlap {
+				best, bestOverlap = i, overlap
+			}
+		}
+		if best < 0 {
+			return nil, fmt.Errorf("no detected face overlaps the requested box")
+		}
+		return []int{best}, nil
+
+	default:
+		largest := 0
+		for i, face := range faces {
+			if area(face) > area(faces[largest]) {
+				largest = i
+			}
+		}
+		return []int{largest}, nil
+	}
+}
+
+// describeFaces reports every detected face, marking the processed ones
+func describeFaces(faces []image.Rectangle, processed []int) []models.DetectedFace {
+	described := make([]models.DetectedFace, len(faces))
+	for i, face := range faces {
+		described[i] = models.DetectedFace{Index: i, Box: toFaceBox(face)}
+	}
+	for _, i := range processed {
+		described[i].Processed = true
+	}
+	return described
+}
+
+func toFaceBox(r image.Rectangle) models.FaceBox {
+	return models.FaceBox{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
+
+func intersectionOverUnion(a, b image.Rectangle) float64 {
+	inter := area(a.Intersect(b))
+	if inter == 0 {
+		return 0
+	}
+	return float64(inter) / float64(area(a)+area(b)-inter)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"makeup-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestParseFaceSelection(t *testing.T) {
+	index := 2
+	negative := -1
+
+	tests := []struct {
+		name    string
+		mode    string
+		index   *int
+		box     *models.FaceBox
+		want    FaceSelection
+		wantErr bool
+	}{
+		{name: "default", want: FaceSelection{Mode: FaceSelectLargest}},
+		{name: "all", mode: " ALL ", want: FaceSelection{Mode: FaceSelectAll}},
+		{name: "index", mode: "index", index: &index, want: FaceSelection{Mode: FaceSelectIndex, Index: 2}},
+		{name: "index missing", mode: "index", wantErr: true},
+		{name: "index negative", mode: "index", index: &negative, wantErr: true},
+		{
+			name: "box",
+			mode: "box",
+			box:  &models.FaceBox{X: 10, Y: 20, Width: 30, Height: 40},
+			want: FaceSelection{Mode: FaceSelectBox, Box: image.Rect(10, 20, 40, 60)},
+		},
+		{name: "box empty", mode: "box", box: &models.FaceBox{Width: 0, Height: 10}, wantErr: true},
+		{name: "unknown mode", mode: "biggest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFaceSelection(tt.mode, tt.index, tt.box)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFaceSelection) {
+					t.Errorf("error = %v, want ErrInvalidFaceSelection", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFaces(t *testing.T) {
+	faces := []image.Rectangle{
+		image.Rect(10, 10, 60, 60),   // 50x50
+		image.Rect(100, 10, 180, 90), // 80x80, largest
+		image.Rect(200, 10, 240, 50), // 40x40
+	}
+
+	tests := []struct {
+		name    string
+		sel     FaceSelection
+		want    []int
+		wantErr bool
+	}{
+		{name: "largest", sel: FaceSelection{Mode: FaceSelectLargest}, want: []int{1}},
+		{name: "all", sel: FaceSelection{Mode: FaceSelectAll}, want: []int{0, 1, 2}},
+		{name: "index", sel: FaceSelection{Mode: FaceSelectIndex, Index: 2}, want: []int{2}},
+		{name: "index out of range", sel: FaceSelection{Mode: FaceSelectIndex, Index: 3}, wantErr: true},
+		{name: "box picks best overlap", sel: FaceSelection{Mode: FaceSelectBox, Box: image.Rect(195, 5, 245, 55)}, want: []int{2}},
+		{name: "box overlapping nothing", sel: FaceSelection{Mode: FaceSelectBox, Box: image.Rect(300, 300, 350, 350)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectFaces(faces, tt.sel)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFaces(t *testing.T) {
+	faces := []image.Rectangle{
+		image.Rect(200, 10, 240, 50),
+		image.Rect(10, 80, 60, 130),
+		image.Rect(10, 10, 60, 60),
+	}
+	sortFaces(faces)
+
+	want := []image.Rectangle{
+		image.Rect(10, 10, 60, 60),
+		image.Rect(10, 80, 60, 130),
+		image.Rect(200, 10, 240, 50),
+	}
+	if !reflect.DeepEqual(faces, want) {
+		t.Errorf("got %v, want %v", faces, want)
+	}
+}
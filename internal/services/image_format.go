@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Canonical image format names, matching those reported by image.Decode
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+)
+
+// webpFileExt selects OpenCV's WebP codec, which gocv has no constant for
+const webpFileExt gocv.FileExt = ".webp"
+
+// ErrInvalidImage is returned when uploaded bytes are not a decodable image
+var ErrInvalidImage = errors.New("invalid image data")
+
+// ErrInvalidBase64 is returned when a base64 upload is not valid base64
+var ErrInvalidBase64 = fmt.Errorf("%w: malformed base64", ErrInvalidImage)
+
+// ErrFormatMismatch is returned when the declared format disagrees with the content
+var ErrFormatMismatch = errors.New("declared image format does not match image content")
+
+var (
+	jpegMagic = []byte{0xFF, 0xD8, 0xFF}
+	pngMagic  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+)
+
+// NormalizeFormat maps client-supplied format names onto the canonical ones
+func NormalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		return FormatJPEG
+	}
+	return format
+}
+
+// SniffFormat identifies an image format from its leading magic bytes and
+// returns "" when the header matches no supported format.
+func SniffFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, jpegMagic):
+		return FormatJPEG
+	case bytes.HasPrefix(header, pngMagic):
+		return FormatPNG
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	default:
+		return ""
+	}
+}
+
+// ContentType returns the MIME type for a canonical format name
+func ContentType(format string) string {
+	switch NormalizeFormat(format) {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// formatExtension returns the file extension used when storing a format
+func formatExtension(format string) string {
+	if format == FormatJPEG {
+		return "jpg"
+	}
+	return format
+}
+
+// encodeMat encodes a BGR mat with OpenCV's codecs, which also provide the
+// WebP encoder the standard library lacks.
+func encodeMat(mat gocv.Mat, format string, quality int) ([]byte, error) {
+	var ext gocv.FileExt
+	var params []int
+	switch format {
+	case FormatJPEG:
+		ext = gocv.JPEGFileExt
+		params = []int{gocv.IMWriteJpegQuality, quality}
+	case FormatPNG:
+		ext = gocv.PNGFileExt
+		params = []int{gocv.IMWritePngCompression, 6}
+	case FormatWebP:
+		ext = webpFileExt
+		params = []int{gocv.IMWriteWebpQuality, quality}
+	default:
+		return nil, fmt.Errorf("%w for encoding: %s", ErrUnsupportedFormat, format)
+	}
+
+	buf, err := gocv.IMEncodeWithParams(ext, mat, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s image: %v", format, err)
+	}
+	defer buf.Close()
+
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("failed to encode %s image: encoder produced no data", format)
+	}
+	// Copy out of the native buffer before it is freed
+	return append([]byte(nil), buf.GetBytes()...), nil
+}
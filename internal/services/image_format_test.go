@@ -0,0 +1,49 @@
+package services
+
+import "testing"
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10}, FormatJPEG},
+		{"jpeg magic only", []byte{0xFF, 0xD8, 0xFF}, FormatJPEG},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), FormatPNG},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), FormatWebP},
+		{"truncated jpeg", []byte{0xFF, 0xD8}, ""},
+		{"truncated png", []byte("\x89PNG\r\n\x1a"), ""},
+		{"truncated webp", []byte("RIFF\x24\x00\x00\x00WEB"), ""},
+		{"riff but not webp", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+		{"webp tag at wrong offset", []byte("WEBPRIFF\x00\x00\x00\x00"), ""},
+		{"png with mangled line endings", []byte("\x89PNG\n\n\x1a\n\x00\x00"), ""},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), ""},
+		{"text", []byte("<svg xmlns="), ""},
+		{"empty", []byte{}, ""},
+		{"nil", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffFormat(tt.header); got != tt.want {
+				t.Errorf("SniffFormat(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeFormat(t *testing.T) {
+	tests := map[string]string{
+		"jpg":    FormatJPEG,
+		" JPEG ": FormatJPEG,
+		"PNG":    FormatPNG,
+		"webp":   FormatWebP,
+		"gif":    "gif",
+		"":       "",
+	}
+	for in, want := range tests {
+		if got := NormalizeFormat(in); got != want {
+			t.Errorf("NormalizeFormat(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
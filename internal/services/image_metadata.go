@@ -0,0 +1,409 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// imageMetadata is the subset of embedded metadata we act on during ingest.
+// Everything else (EXIF, GPS, XMP, comments) is dropped by re-encoding.
+type imageMetadata struct {
+	Orientation int    // EXIF orientation 1-8, 0 when absent
+	ICCProfile  []byte // raw ICC colour profile, nil when absent
+}
+
+const (
+	exifOrientationTag = 0x0112
+	iccChunkMax        = 65519   // APP2 payload minus the ICC_PROFILE header
+	iccProfileMax      = 4 << 20 // real profiles are well under this
+
+	webpICCFlag   = 0x20 // VP8X flag bits
+	webpAlphaFlag = 0x10
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// readMetadata extracts the orientation and, when withICC is set, the ICC
+// profile from a stored image. Malformed metadata is ignored rather than
+// failing the upload.
+func readMetadata(path string, format string, withICC bool) imageMetadata {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return imageMetadata{}
+	}
+	return parseMetadata(data, format, withICC)
+}
+
+// readICCProfile returns the ICC profile embedded in a stored image, if any
+func readICCProfile(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseMetadata(data, SniffFormat(data), true).ICCProfile
+}
+
+func parseMetadata(data []byte, format string, withICC bool) imageMetadata {
+	switch format {
+	case FormatJPEG:
+		return readJPEGMetadata(data, withICC)
+	case FormatPNG:
+		return readPNGMetadata(data, withICC)
+	case FormatWebP:
+		return readWebPMetadata(data, withICC)
+	default:
+		return imageMetadata{}
+	}
+}
+
+func readJPEGMetadata(data []byte, withICC bool) imageMetadata {
+	var meta imageMetadata
+	iccChunks := map[int][]byte{}
+
+	// Walk marker segments until the start of scan
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		payload := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			meta.Orientation = parseExifOrientation(payload[len(exifHeader):])
+		case withICC && marker == 0xE2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2:
+			seq := int(payload[len(iccHeader)])
+			iccChunks[seq] = payload[len(iccHeader)+2:]
+		}
+		pos += 2 + length
+	}
+
+	if len(iccChunks) > 0 {
+		seqs := make([]int, 0, len(iccChunks))
+		for seq := range iccChunks {
+			seqs = append(seqs, seq)
+		}
+		sort.Ints(seqs)
+		for _, seq := range seqs {
+			meta.ICCProfile = append(meta.ICCProfile, iccChunks[seq]...)
+		}
+		if len(meta.ICCProfile) > iccProfileMax {
+			meta.ICCProfile = nil
+		}
+	}
+	return meta
+}
+
+func readPNGMetadata(data []byte, withICC bool) imageMetadata {
+	var meta imageMetadata
+
+	pos := len(pngMagic)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		payload := data[pos+8 : pos+8+length]
+
+		switch chunkType {
+		case "eXIf":
+			meta.Orientation = parseExifOrientation(payload)
+		case "iCCP":
+			if withICC {
+				meta.ICCProfile = inflateICC(payload)
+			}
+		case "IEND":
+			return meta
+		}
+		pos += 12 + length
+	}
+	return meta
+}
+
+// inflateICC decompresses an iCCP payload (profile name, NUL, compression
+// method, zlib stream). Profiles over iccProfileMax are dropped so a small
+// chunk cannot inflate into a huge allocation.
+func inflateICC(payload []byte) []byte {
+	nul := bytes.IndexByte(payload, 0)
+	if nul < 0 || nul+2 > len(payload) {
+		return nil
+	}
+	r, err := zlib.NewReader(bytes.NewReader(payload[nul+2:]))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	profile, err := io.ReadAll(io.LimitReader(r, iccProfileMax+1))
+	if err != nil || len(profile) > iccProfileMax {
+		return nil
+	}
+	return profile
+}
+
+func readWebPMetadata(data []byte, withICC bool) imageMetadata {
+	var meta imageMetadata
+
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if length < 0 || pos+8+length > len(data) {
+			break
+		}
+		payload := data[pos+8 : pos+8+length]
+
+		switch chunkType {
+		case "EXIF":
+			meta.Orientation = parseExifOrientation(bytes.TrimPrefix(payload, exifHeader))
+		case "ICCP":
+			if withICC && len(payload) <= iccProfileMax {
+				meta.ICCProfile = append([]byte(nil), payload...)
+			}
+		}
+		// Chunks are padded to an even size
+		pos += 8 + length + length%2
+	}
+	return meta
+}
+
+// parseExifOrientation reads the orientation tag from IFD0 of a TIFF-encoded
+// EXIF block, returning 0 when it is absent or malformed.
+func parseExifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == exifOrientationTag {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+	return 0
+}
+
+// applyOrientation transforms img so it displays upright without the EXIF tag
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
+
+// embedICCProfile inserts an ICC profile into freshly encoded image data
+func embedICCProfile(data []byte, format string, icc []byte) []byte {
+	if len(icc) == 0 {
+		return data
+	}
+
+	switch format {
+	case FormatJPEG:
+		return embedJPEGICC(data, icc)
+	case FormatPNG:
+		return embedPNGICC(data, icc)
+	case FormatWebP:
+		return embedWebPICC(data, icc)
+	default:
+		return data
+	}
+}
+
+// embedJPEGICC writes the profile as APP2 segments after SOI, keeping a
+// leading JFIF APP0 segment first as the spec requires.
+func embedJPEGICC(data []byte, icc []byte) []byte {
+	if len(data) < 4 {
+		return data
+	}
+
+	insertAt := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		insertAt = 4 + int(binary.BigEndian.Uint16(data[4:6]))
+		if insertAt > len(data) {
+			return data
+		}
+	}
+
+	count := (len(icc) + iccChunkMax - 1) / iccChunkMax
+	if count > 255 {
+		return data
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:insertAt])
+	for i := 0; i < count; i++ {
+		chunk := icc[i*iccChunkMax:]
+		if len(chunk) > iccChunkMax {
+			chunk = chunk[:iccChunkMax]
+		}
+		length := 2 + len(iccHeader) + 2 + len(chunk)
+		out.Write([]byte{0xFF, 0xE2, byte(length >> 8), byte(length)})
+		out.Write(iccHeader)
+		out.Write([]byte{byte(i + 1), byte(count)})
+		out.Write(chunk)
+	}
+	out.Write(data[insertAt:])
+	return out.Bytes()
+}
+
+// embedPNGICC writes the profile as an iCCP chunk right after IHDR
+func embedPNGICC(data []byte, icc []byte) []byte {
+	// signature (8) + IHDR chunk (4 length + 4 type + 13 data + 4 crc)
+	ihdrEnd := len(pngMagic) + 25
+	if len(data) < ihdrEnd {
+		return data
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(icc)
+	zw.Close()
+
+	payload := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+	chunk := make([]byte, 0, len(payload)+12)
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, "iCCP"...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+// embedWebPICC writes the profile as an ICCP chunk. Simple lossy (VP8) and
+// lossless (VP8L) files are converted to the extended layout, whose VP8X
+// header announces the profile and must precede it.
+func embedWebPICC(data []byte, icc []byte) []byte {
+	if len(data) < 30 || SniffFormat(data) != FormatWebP {
+		return data
+	}
+
+	out := append([]byte(nil), data[:12]...)
+	switch string(data[12:16]) {
+	case "VP8X":
+		vp8x := append([]byte(nil), data[12:30]...)
+		vp8x[8] |= webpICCFlag
+		out = append(out, vp8x...)
+		out = append(out, riffChunk("ICCP", icc)...)
+		out = append(out, data[30:]...)
+	case "VP8 ", "VP8L":
+		width, height, alpha, ok := webpCanvasSize(data[12:])
+		if !ok {
+			return data
+		}
+		header := make([]byte, 10)
+		header[0] = webpICCFlag
+		if alpha {
+			header[0] |= webpAlphaFlag
+		}
+		putUint24LE(header[4:7], width-1)
+		putUint24LE(header[7:10], height-1)
+		out = append(out, riffChunk("VP8X", header)...)
+		out = append(out, riffChunk("ICCP", icc)...)
+		out = append(out, data[12:]...)
+	default:
+		return data
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out
+}
+
+// webpCanvasSize reads the image size from a VP8 or VP8L chunk
+func webpCanvasSize(chunk []byte) (width, height int, alpha, ok bool) {
+	payload := chunk[8:]
+	switch string(chunk[0:4]) {
+	case "VP8 ":
+		// frame tag (3), start code 9d 01 2a, then 14-bit width and height
+		if len(payload) < 10 || !bytes.Equal(payload[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, false, false
+		}
+		width = int(binary.LittleEndian.Uint16(payload[6:8]) & 0x3FFF)
+		height = int(binary.LittleEndian.Uint16(payload[8:10]) & 0x3FFF)
+		return width, height, false, width > 0 && height > 0
+	case "VP8L":
+		// signature 0x2f, then 14-bit width-1, 14-bit height-1 and alpha hint
+		if len(payload) < 5 || payload[0] != 0x2F {
+			return 0, 0, false, false
+		}
+		bits := binary.LittleEndian.Uint32(payload[1:5])
+		width = int(bits&0x3FFF) + 1
+		height = int(bits>>14&0x3FFF) + 1
+		return width, height, bits>>28&1 == 1, true
+	}
+	return 0, 0, false, false
+}
+
+// riffChunk frames a payload as a RIFF chunk, padded to an even size
+func riffChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 0, len(payload)+9)
+	chunk = append(chunk, fourCC...)
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func putUint24LE(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
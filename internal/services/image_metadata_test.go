@@ -0,0 +1,334 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// tiffOrientation builds a TIFF block whose IFD0 holds one orientation entry
+func tiffOrientation(order binary.ByteOrder, value uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:4], 42)
+	order.PutUint32(tiff[4:8], 8)
+	order.PutUint16(tiff[8:10], 1)
+	entry := tiff[10:22]
+	order.PutUint16(entry[0:2], exifOrientationTag)
+	order.PutUint16(entry[2:4], 3) // SHORT
+	order.PutUint32(entry[4:8], 1)
+	order.PutUint16(entry[8:10], value)
+	return tiff
+}
+
+func TestParseExifOrientation(t *testing.T) {
+	valid := tiffOrientation(binary.LittleEndian, 6)
+
+	badIFD := tiffOrientation(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(badIFD[4:8], 1000)
+
+	tooManyEntries := tiffOrientation(binary.BigEndian, 6)
+	binary.BigEndian.PutUint16(tooManyEntries[8:10], 50)
+	binary.BigEndian.PutUint16(tooManyEntries[10:12], 0x0100)
+
+	otherTag := tiffOrientation(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint16(otherTag[10:12], 0x0100)
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", valid, 6},
+		{"big endian", tiffOrientation(binary.BigEndian, 8), 8},
+		{"out of range value", tiffOrientation(binary.LittleEndian, 9), 0},
+		{"zero value", tiffOrientation(binary.LittleEndian, 0), 0},
+		{"tag absent", otherTag, 0},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...), 0},
+		{"ifd offset past end", badIFD, 0},
+		{"entry count past end", tooManyEntries, 0},
+		{"truncated header", valid[:6], 0},
+		{"truncated entry", valid[:16], 0},
+		{"empty", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseExifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("parseExifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 60), uint8(y * 80), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegSegment frames a payload as a JPEG marker segment
+func jpegSegment(marker byte, payload []byte) []byte {
+	length := len(payload) + 2
+	return append([]byte{0xFF, marker, byte(length >> 8), byte(length)}, payload...)
+}
+
+// pngChunk frames a payload as a PNG chunk
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// insertAfterIHDR places chunks between the IHDR chunk and the rest of a PNG
+func insertAfterIHDR(data []byte, chunks ...[]byte) []byte {
+	ihdrEnd := len(pngMagic) + 25
+	out := append([]byte(nil), data[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+func profile(size int) []byte {
+	icc := make([]byte, size)
+	for i := range icc {
+		icc[i] = byte(i * 7)
+	}
+	return icc
+}
+
+func TestReadJPEGMetadata(t *testing.T) {
+	encoded := encodeJPEG(t)
+	icc := profile(300)
+
+	// ICC chunks are stored out of order and must be joined by sequence
+	second := append(append([]byte(nil), iccHeader...), 2, 2)
+	second = append(second, icc[100:]...)
+	first := append(append([]byte(nil), iccHeader...), 1, 2)
+	first = append(first, icc[:100]...)
+
+	var data []byte
+	data = append(data, encoded[:2]...)
+	data = append(data, jpegSegment(0xE1, append(append([]byte(nil), exifHeader...), tiffOrientation(binary.BigEndian, 3)...))...)
+	data = append(data, jpegSegment(0xE2, second)...)
+	data = append(data, jpegSegment(0xE2, first)...)
+	data = append(data, encoded[2:]...)
+
+	meta := parseMetadata(data, FormatJPEG, true)
+	if meta.Orientation != 3 {
+		t.Errorf("Orientation = %d, want 3", meta.Orientation)
+	}
+	if !bytes.Equal(meta.ICCProfile, icc) {
+		t.Errorf("ICCProfile has %d bytes, want the %d byte profile", len(meta.ICCProfile), len(icc))
+	}
+
+	meta = parseMetadata(data, FormatJPEG, false)
+	if meta.Orientation != 3 || meta.ICCProfile != nil {
+		t.Errorf("without ICC got orientation %d and %d profile bytes, want 3 and none", meta.Orientation, len(meta.ICCProfile))
+	}
+
+	// A segment length running past the end stops the walk
+	broken := append([]byte(nil), data[:2]...)
+	broken = append(broken, 0xFF, 0xE1, 0xFF, 0xFF)
+	broken = append(broken, data[2:40]...)
+	if meta := parseMetadata(broken, FormatJPEG, true); meta.Orientation != 0 || meta.ICCProfile != nil {
+		t.Errorf("overlong segment: got %+v, want no metadata", meta)
+	}
+}
+
+func TestReadPNGMetadata(t *testing.T) {
+	encoded := encodePNG(t)
+	icc := profile(500)
+
+	data := insertAfterIHDR(embedPNGICC(encoded, icc), pngChunk("eXIf", tiffOrientation(binary.LittleEndian, 8)))
+	meta := parseMetadata(data, FormatPNG, true)
+	if meta.Orientation != 8 {
+		t.Errorf("Orientation = %d, want 8", meta.Orientation)
+	}
+	if !bytes.Equal(meta.ICCProfile, icc) {
+		t.Errorf("ICCProfile has %d bytes, want the %d byte profile", len(meta.ICCProfile), len(icc))
+	}
+	if meta := parseMetadata(data, FormatPNG, false); meta.ICCProfile != nil {
+		t.Errorf("without ICC got %d profile bytes, want none", len(meta.ICCProfile))
+	}
+}
+
+func TestReadPNGMetadataRejectsOversizedICC(t *testing.T) {
+	// A few KB of zlib that inflates past the profile limit
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(make([]byte, iccProfileMax+1))
+	zw.Close()
+
+	bomb := pngChunk("iCCP", append([]byte("bomb\x00\x00"), compressed.Bytes()...))
+	data := insertAfterIHDR(encodePNG(t), bomb)
+	if meta := parseMetadata(data, FormatPNG, true); meta.ICCProfile != nil {
+		t.Errorf("got %d profile bytes, want the oversized profile dropped", len(meta.ICCProfile))
+	}
+}
+
+func TestReadPNGMetadataMalformedICC(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"no name terminator", []byte("profile")},
+		{"no compression method", []byte("profile\x00")},
+		{"not zlib", []byte("profile\x00\x00not zlib data")},
+		{"truncated zlib", func() []byte {
+			var compressed bytes.Buffer
+			zw := zlib.NewWriter(&compressed)
+			zw.Write(profile(1000))
+			zw.Close()
+			return append([]byte("profile\x00\x00"), compressed.Bytes()[:20]...)
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := insertAfterIHDR(encodePNG(t), pngChunk("iCCP", tt.payload))
+			if meta := parseMetadata(data, FormatPNG, true); meta.ICCProfile != nil {
+				t.Errorf("got %d profile bytes, want none", len(meta.ICCProfile))
+			}
+		})
+	}
+}
+
+// simpleWebP builds a WebP file with a VP8L header for the given size; the
+// bitstream after the header is not valid image data
+func simpleWebP(width, height int, alpha bool) []byte {
+	bits := uint32(width-1) | uint32(height-1)<<14
+	if alpha {
+		bits |= 1 << 28
+	}
+	payload := append([]byte{0x2F}, binary.LittleEndian.AppendUint32(nil, bits)...)
+	payload = append(payload, make([]byte, 20)...)
+
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), riffChunk("VP8L", payload)...)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data
+}
+
+func TestEmbedWebPICC(t *testing.T) {
+	icc := profile(301) // odd, so the chunk needs padding
+
+	tests := []struct {
+		name  string
+		alpha bool
+	}{
+		{"opaque", false},
+		{"alpha", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := embedWebPICC(simpleWebP(640, 480, tt.alpha), icc)
+
+			if got := binary.LittleEndian.Uint32(data[4:8]); int(got) != len(data)-8 {
+				t.Errorf("RIFF size = %d, want %d", got, len(data)-8)
+			}
+			if string(data[12:16]) != "VP8X" {
+				t.Fatalf("first chunk is %q, want VP8X", data[12:16])
+			}
+			if flags := data[20]; flags&webpICCFlag == 0 || (flags&webpAlphaFlag != 0) != tt.alpha {
+				t.Errorf("VP8X flags = %#x", flags)
+			}
+
+			width := int(data[24]) | int(data[25])<<8 | int(data[26])<<16 + 1
+			height := int(data[27]) | int(data[28])<<8 | int(data[29])<<16 + 1
+			if width != 640 || height != 480 {
+				t.Errorf("canvas is %dx%d, want 640x480", width, height)
+			}
+
+			if meta := parseMetadata(data, FormatWebP, true); !bytes.Equal(meta.ICCProfile, icc) {
+				t.Errorf("ICCProfile has %d bytes, want the %d byte profile", len(meta.ICCProfile), len(icc))
+			}
+		})
+	}
+
+	// An extended file only gains the flag and the chunk
+	extended := embedWebPICC(simpleWebP(10, 10, false), []byte{1, 2})
+	again := embedWebPICC(extended, icc)
+	if !bytes.Equal(again[12:20], extended[12:20]) || again[20]&webpICCFlag == 0 {
+		t.Errorf("VP8X header was not kept")
+	}
+
+	// Files it cannot parse are returned unchanged
+	unknown := simpleWebP(10, 10, false)
+	copy(unknown[12:16], "ANIM")
+	for _, data := range [][]byte{unknown, simpleWebP(10, 10, false)[:25], []byte("not a webp")} {
+		if got := embedWebPICC(data, icc); !bytes.Equal(got, data) {
+			t.Errorf("embedWebPICC changed unparseable data %q", data[:10])
+		}
+	}
+}
+
+func TestEmbedICCProfileRoundTrip(t *testing.T) {
+	// Larger than one JPEG APP2 segment
+	icc := profile(iccChunkMax + 1000)
+
+	tests := []struct {
+		format string
+		data   []byte
+	}{
+		{FormatJPEG, encodeJPEG(t)},
+		{FormatPNG, encodePNG(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data := embedICCProfile(tt.data, tt.format, icc)
+			if meta := parseMetadata(data, tt.format, true); !bytes.Equal(meta.ICCProfile, icc) {
+				t.Errorf("ICCProfile has %d bytes, want the %d byte profile", len(meta.ICCProfile), len(icc))
+			}
+			if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != tt.format {
+				t.Errorf("image.Decode() = %s, %v; want a valid %s", format, err, tt.format)
+			}
+		})
+	}
+}
+
+func TestParseMetadataTruncated(t *testing.T) {
+	icc := profile(200)
+	files := map[string][]byte{
+		FormatJPEG: embedICCProfile(encodeJPEG(t), FormatJPEG, icc),
+		FormatPNG:  embedICCProfile(encodePNG(t), FormatPNG, icc),
+		FormatWebP: embedICCProfile(simpleWebP(8, 8, false), FormatWebP, icc),
+	}
+	// Every prefix must parse without panicking
+	for format, data := range files {
+		for n := 0; n < len(data); n++ {
+			parseMetadata(data[:n], format, true)
+		}
+	}
+}
@@ -1,65 +1,166 @@
 package services
 
 import (
+	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/disintegration/imaging"
 	"github.com/google/uuid"
+	"gocv.io/x/gocv"
+	_ "golang.org/x/image/webp" // register the WebP decoder with image.Decode
 )
 
+// ErrFileTooLarge is returned when an upload exceeds the configured byte limit
+var ErrFileTooLarge = errors.New("image file too large")
+
+// ErrUnsupportedFormat is returned for formats outside the allowed list
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrTooManyPixels is returned when an image header declares dimensions
+// beyond the configured limits
+var ErrTooManyPixels = errors.New("image dimensions exceed limits")
+
+// ImageConfig holds upload limits for ImageService
+type ImageConfig struct {
+	MaxFileSize int64
+	// Uploads larger than this are downscaled to fit, keeping aspect ratio
+	MaxImageWidth  int
+	MaxImageHeight int
+	// Images whose header declares more than this are rejected before decoding
+	MaxPixelWidth  int
+	MaxPixelHeight int
+	MaxMegapixels  float64
+	// Keep the ICC colour profile when stripping metadata from stored images
+	PreserveICCProfile bool
+	// Filter used when downscaling; the zero value selects Lanczos
+	ResampleFilter imaging.ResampleFilter
+}
+
 type ImageService struct {
-	uploadDir string
+	uploadDir      string
+	maxFileSize    int64
+	maxImageWidth  int
+	maxImageHeight int
+	maxPixelWidth  int
+	maxPixelHeight int
+	maxMegapixels  float64
+	preserveICC    bool
+	resampleFilter imaging.ResampleFilter
+	images         repository.ImageRepository
 }
 
-func NewImageService() *ImageService {
+func NewImageService(config ImageConfig, images repository.ImageRepository) *ImageService {
 	uploadDir := "uploads"
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = 10 * 1024 * 1024 // 10MB
+	}
+	if config.MaxImageWidth <= 0 {
+		config.MaxImageWidth = 1920
+	}
+	if config.MaxImageHeight <= 0 {
+		config.MaxImageHeight = 1080
+	}
+	if config.MaxPixelWidth <= 0 {
+		config.MaxPixelWidth = 8000
+	}
+	if config.MaxPixelHeight <= 0 {
+		config.MaxPixelHeight = 8000
+	}
+	if config.MaxMegapixels <= 0 {
+		config.MaxMegapixels = 40
+	}
+	if config.ResampleFilter.Kernel == nil {
+		config.ResampleFilter = imaging.Lanczos
+	}
+
 	os.MkdirAll(uploadDir, 0755)
 	os.MkdirAll(filepath.Join(uploadDir, "results"), 0755)
-	
+
 	return &ImageService{
-		uploadDir: uploadDir,
+		uploadDir:      uploadDir,
+		maxFileSize:    config.MaxFileSize,
+		maxImageWidth:  config.MaxImageWidth,
+		maxImageHeight: config.MaxImageHeight,
+		maxPixelWidth:  config.MaxPixelWidth,
+		maxPixelHeight: config.MaxPixelHeight,
+		maxMegapixels:  config.MaxMegapixels,
+		preserveICC:    config.PreserveICCProfile,
+		resampleFilter: config.ResampleFilter,
+		images:         images,
 	}
 }
 
+// MaxFileSize returns the largest accepted upload in bytes
+func (is *ImageService) MaxFileSize() int64 {
+	return is.maxFileSize
+}
+
 func (is *ImageService) SaveImageFromBase64(imageData string, format string) (*models.UploadedImage, error) {
-	// Remove data URL prefix if present
-	if strings.Contains(imageData, ",") {
-		parts := strings.SplitN(imageData, ",", 2)
-		if len(parts) == 2 {
-			imageData = parts[1]
+	// Decode base64 data while streaming it to disk
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(stripDataURL(imageData)))
+	return is.SaveImageFromReader(decoder, format)
+}
+
+// stripDataURL removes a data URL prefix if present
+func stripDataURL(imageData string) string {
+	if _, data, found := strings.Cut(imageData, ","); found {
+		return data
+	}
+	return imageData
+}
+
+// SaveImageFromReader streams an image to the upload directory, enforcing
+// the configured size limit without buffering the whole body in memory. The
+// stored bytes are sniffed and decoded once; format may be empty, in which
+// case the detected format is used, otherwise it must match the content.
+// The stored original is auto-oriented and re-encoded without metadata.
+func (is *ImageService) SaveImageFromReader(r io.Reader, format string) (*models.UploadedImage, error) {
+	declared := NormalizeFormat(format)
+	if declared != "" {
+		if err := is.ValidateImageFormat(declared); err != nil {
+			return nil, err
 		}
 	}
 
-	// Decode base64 data
-	decoded, err := base64.StdEncoding.DecodeString(imageData)
+	imageID := uuid.New().String()
+	tempPath := filepath.Join(is.uploadDir, imageID+".upload")
+	if err := is.writeLimited(tempPath, r); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempPath)
+
+	img, actual, err := is.decodeUpload(tempPath, declared)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode base64 image: %v", err)
+		return nil, err
 	}
 
-	// Generate unique filename
-	imageID := uuid.New().String()
-	filename := fmt.Sprintf("%s.%s", imageID, format)
+	filename := fmt.Sprintf("%s.%s", imageID, formatExtension(actual))
 	filePath := filepath.Join(is.uploadDir, filename)
 
-	// Create file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create file: %v", err)
+	// Bake the EXIF orientation into the pixels so faces are upright
+	meta := readMetadata(tempPath, actual, is.preserveICC)
+	img = applyOrientation(img, meta.Orientation)
+
+	// Downscale oversized images
+	if resized, ok := is.resizeToFit(img, is.maxImageWidth, is.maxImageHeight); ok {
+		img = resized
 	}
-	defer file.Close()
 
-	// Write image data
-	_, err = file.Write(decoded)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write image data: %v", err)
+	// Re-encode so EXIF, GPS and other metadata never reach storage
+	if err := writeImage(filePath, img, actual, meta.ICCProfile); err != nil {
+		return nil, err
 	}
 
 	// Get file info
@@ -68,46 +169,152 @@ func (is *ImageService) SaveImageFromBase64(imageData string, format string) (*m
 		return nil, fmt.Errorf("failed to get file info: %v", err)
 	}
 
+	bounds := img.Bounds()
 	return &models.UploadedImage{
 		ID:        imageID,
 		Filename:  filename,
 		FilePath:  filePath,
-		Format:    format,
+		Format:    actual,
 		Size:      fileInfo.Size(),
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		CreatedAt: time.Now(),
 	}, nil
 }
 
-func (is *ImageService) ValidateImageFormat(format string) error {
-	allowedFormats := []string{"jpg", "jpeg", "png", "webp"}
-	for _, allowed := range allowedFormats {
-		if strings.ToLower(format) == allowed {
-			return nil
-		}
+// writeLimited copies r to path, reading one byte past the limit to detect
+// oversize bodies. The file is removed on failure.
+func (is *ImageService) writeLimited(path string, r io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, io.LimitReader(r, is.maxFileSize+1))
+	var corrupt base64.CorruptInputError
+	switch {
+	case errors.As(err, &corrupt):
+		err = fmt.Errorf("%w: %v", ErrInvalidBase64, err)
+	case err != nil:
+		err = fmt.Errorf("failed to write image data: %v", err)
+	case written > is.maxFileSize:
+		err = fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, is.maxFileSize)
+	case written == 0:
+		err = fmt.Errorf("%w: image data is empty", ErrInvalidImage)
+	}
+	if err != nil {
+		os.Remove(path)
 	}
-	return fmt.Errorf("unsupported image format: %s", format)
+	return err
 }
 
-func (is *ImageService) ValidateImageSize(imageData string) error {
-	// Remove data URL prefix if present
-	if strings.Contains(imageData, ",") {
-		parts := strings.SplitN(imageData, ",", 2)
-		if len(parts) == 2 {
-			imageData = parts[1]
-		}
+// decodeUpload sniffs the stored bytes, checks them against the declared
+// format and fully decodes the image.
+func (is *ImageService) decodeUpload(path string, declared string) (image.Image, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(file, header)
+	actual := SniffFormat(header[:n])
+	if actual == "" {
+		return nil, "", fmt.Errorf("%w: content is not a JPEG, PNG or WebP image", ErrInvalidImage)
+	}
+	if declared != "" && declared != actual {
+		return nil, "", fmt.Errorf("%w: declared %s but content is %s", ErrFormatMismatch, declared, actual)
+	}
+
+	img, _, err := is.decodeChecked(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, actual, nil
+}
+
+// decodeChecked reads the image header first and only performs the full
+// decode when the declared dimensions are within limits, so a small file
+// cannot force a huge allocation.
+func (is *ImageService) decodeChecked(file io.ReadSeeker) (image.Image, string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %v", err)
+	}
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: failed to read image header: %v", ErrInvalidImage, err)
+	}
+	if err := is.checkDimensions(config.Width, config.Height); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %v", err)
+	}
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: failed to decode %s image: %v", ErrInvalidImage, format, err)
+	}
+	return img, format, nil
+}
+
+func (is *ImageService) checkDimensions(width, height int) error {
+	if width > is.maxPixelWidth || height > is.maxPixelHeight {
+		return fmt.Errorf("%w: %dx%d pixels (max %dx%d)", ErrTooManyPixels, width, height, is.maxPixelWidth, is.maxPixelHeight)
+	}
+	megapixels := float64(width) * float64(height) / 1e6
+	if megapixels > is.maxMegapixels {
+		return fmt.Errorf("%w: %.1f megapixels (max %.1f)", ErrTooManyPixels, megapixels, is.maxMegapixels)
 	}
+	return nil
+}
 
-	// Decode to check size
-	decoded, err := base64.StdEncoding.DecodeString(imageData)
+// RegisterImage records a stored upload in the image registry so later
+// requests can resolve it by ID.
+func (is *ImageService) RegisterImage(img *models.UploadedImage) error {
+	if err := is.images.Save(*img); err != nil {
+		return fmt.Errorf("failed to store image metadata: %v", err)
+	}
+	return nil
+}
+
+// GetImage looks up an uploaded image by ID. repository.ErrNotFound is
+// returned for unknown IDs or when the file has since been removed.
+func (is *ImageService) GetImage(imageID string) (models.UploadedImage, error) {
+	img, err := is.images.Get(imageID)
 	if err != nil {
-		return fmt.Errorf("failed to decode image: %v", err)
+		return img, err
 	}
 
-	// Check file size (max 10MB)
-	maxSize := 10 * 1024 * 1024 // 10MB
-	if len(decoded) > maxSize {
-		return fmt.Errorf("image too large: %d bytes (max %d bytes)", len(decoded), maxSize)
+	if _, err := os.Stat(img.FilePath); os.IsNotExist(err) {
+		return img, repository.ErrNotFound
 	}
+	return img, nil
+}
 
+func (is *ImageService) ValidateImageFormat(format string) error {
+	allowedFormats := []string{FormatJPEG, FormatPNG, FormatWebP}
+	for _, allowed := range allowedFormats {
+		if NormalizeFormat(format) == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// ValidateImageSize rejects base64 image data whose decoded size would
+// exceed the limit. The size is computed from the encoded length without
+// decoding (line breaks make it an overestimate); the content itself is
+// checked while it is saved.
+func (is *ImageService) ValidateImageSize(imageData string) error {
+	imageData = strings.TrimRight(stripDataURL(imageData), "=")
+	size := int64(base64.RawStdEncoding.DecodedLen(len(imageData)))
+	if size > is.maxFileSize {
+		return fmt.Errorf("%w: %d bytes (max %d bytes)", ErrFileTooLarge, size, is.maxFileSize)
+	}
 	return nil
 }
 
@@ -125,8 +332,8 @@ func (is *ImageService) GetImageDimensions(filePath string) (int, int, error) {
 	}
 
 	// Validate format
-	if format != "jpeg" && format != "png" {
-		return 0, 0, fmt.Errorf("unsupported image format: %s", format)
+	if err := is.ValidateImageFormat(format); err != nil {
+		return 0, 0, err
 	}
 
 	return img.Width, img.Height, nil
@@ -140,78 +347,128 @@ func (is *ImageService) ResizeImage(filePath string, maxWidth, maxHeight int) er
 	}
 	defer file.Close()
 
-	// Decode the image
-	img, format, err := image.Decode(file)
+	// Decode the image, checking its header against the pixel limits first
+	img, format, err := is.decodeChecked(file)
 	if err != nil {
-		return fmt.Errorf("failed to decode image: %v", err)
+		return err
 	}
 
-	// Get original dimensions
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-
-	// Calculate new dimensions maintaining aspect ratio
-	newWidth, newHeight := width, height
-	if width > maxWidth || height > maxHeight {
-		ratio := float64(width) / float64(height)
-		if width > height {
-			newWidth = maxWidth
-			newHeight = int(float64(maxWidth) / ratio)
-		} else {
-			newHeight = maxHeight
-			newWidth = int(float64(maxHeight) * ratio)
-		}
+	// Only resize if necessary
+	resized, ok := is.resizeToFit(img, maxWidth, maxHeight)
+	if !ok {
+		return nil
 	}
 
-	// Only resize if necessary
-	if newWidth != width || newHeight != height {
-		// Create resized image
-		resized := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-		
-		// Simple nearest neighbor resize (for better performance)
-		for y := 0; y < newHeight; y++ {
-			for x := 0; x < newWidth; x++ {
-				srcX := x * width / newWidth
-				srcY := y * height / newHeight
-				resized.Set(x, y, img.At(srcX, srcY))
-			}
-		}
+	var icc []byte
+	if is.preserveICC {
+		icc = readICCProfile(filePath)
+	}
+	return writeImage(filePath, resized, format, icc)
+}
 
-		// Save the resized image
-		outFile, err := os.Create(filePath)
-		if err != nil {
-			return fmt.Errorf("failed to create resized image: %v", err)
-		}
-		defer outFile.Close()
-
-		// Encode based on original format
-		switch format {
-		case "jpeg":
-			err = jpeg.Encode(outFile, resized, &jpeg.Options{Quality: 95})
-		case "png":
-			err = png.Encode(outFile, resized)
-		default:
-			return fmt.Errorf("unsupported format for resizing: %s", format)
-		}
+// ParseResampleFilter maps a filter name to an imaging filter. An empty name
+// selects Lanczos, which gives the sharpest downscale of skin texture.
+func ParseResampleFilter(name string) (imaging.ResampleFilter, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "lanczos":
+		return imaging.Lanczos, nil
+	case "catmullrom":
+		return imaging.CatmullRom, nil
+	case "box":
+		return imaging.Box, nil
+	default:
+		return imaging.ResampleFilter{}, fmt.Errorf("unknown resample filter %q (want lanczos, catmullrom or box)", name)
+	}
+}
 
-		if err != nil {
-			return fmt.Errorf("failed to encode resized image: %v", err)
-		}
+// resizeToFit scales img down to fit within maxWidth x maxHeight keeping the
+// aspect ratio. It reports false when the image already fits.
+func (is *ImageService) resizeToFit(img image.Image, maxWidth, maxHeight int) (image.Image, bool) {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxWidth && bounds.Dy() <= maxHeight {
+		return img, false
 	}
+	return imaging.Fit(img, maxWidth, maxHeight, is.resampleFilter), true
+}
 
+// writeImage encodes img to path in the given format. Only pixel data is
+// written, plus the ICC profile when one is given.
+func writeImage(path string, img image.Image, format string, icc []byte) error {
+	var buf bytes.Buffer
+	var err error
+
+	// Encode based on original format
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatWebP:
+		err = encodeWebP(&buf, img)
+	default:
+		return fmt.Errorf("%w for encoding: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	if err := os.WriteFile(path, embedICCProfile(buf.Bytes(), format, icc), 0644); err != nil {
+		return fmt.Errorf("failed to write image file: %v", err)
+	}
 	return nil
 }
 
+// encodeWebP encodes img as WebP through OpenCV
+func encodeWebP(w io.Writer, img image.Image) error {
+	mat, err := gocv.ImageToMatRGB(img)
+	if err != nil {
+		return fmt.Errorf("failed to convert image: %v", err)
+	}
+	defer mat.Close()
+
+	data, err := encodeMat(mat, FormatWebP, 95)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
 func (is *ImageService) CleanupOldFiles() error {
 	// This function would clean up old uploaded files
 	// Implementation depends on your cleanup strategy
 	return nil
 }
 
+// GetImageURL converts a stored file path to the URL it is served under,
+// keeping subdirectories such as results/ in the path.
 func (is *ImageService) GetImageURL(filePath string) string {
-	// Convert file path to URL
-	// This would typically involve your CDN or static file serving setup
-	return "/uploads/" + filepath.Base(filePath)
+	rel, err := filepath.Rel(is.uploadDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(filePath)
+	}
+	return "/uploads/" + filepath.ToSlash(rel)
 }
 
+// OpenUpload opens a stored image by its path relative to the upload
+// directory. Anything outside the directory, directories themselves and
+// in-flight uploads are reported as os.ErrNotExist.
+func (is *ImageService) OpenUpload(relPath string) (*os.File, os.FileInfo, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(relPath))
+	format := NormalizeFormat(strings.TrimPrefix(filepath.Ext(clean), "."))
+	if is.ValidateImageFormat(format) != nil {
+		return nil, nil, os.ErrNotExist
+	}
+
+	file, err := os.Open(filepath.Join(is.uploadDir, clean))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil, os.ErrNotExist
+	}
+	return file, info, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func testImageService(t *testing.T) *ImageService {
+	t.Helper()
+	return &ImageService{
+		uploadDir:      t.TempDir(),
+		maxFileSize:    1 << 20,
+		maxImageWidth:  1920,
+		maxImageHeight: 1080,
+		maxPixelWidth:  100,
+		maxPixelHeight: 100,
+		maxMegapixels:  1,
+		resampleFilter: imaging.Lanczos,
+	}
+}
+
+func TestSaveImageFromReaderValidatesContent(t *testing.T) {
+	jpegData := encodeJPEG(t)
+	pngData := encodePNG(t)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		format  string
+		want    string
+		wantErr error
+	}{
+		{"jpeg detected", jpegData, "", FormatJPEG, nil},
+		{"png declared", pngData, "png", FormatPNG, nil},
+		{"jpg alias", jpegData, "jpg", FormatJPEG, nil},
+		{"declared format mismatch", pngData, "jpeg", "", ErrFormatMismatch},
+		{"unsupported declared format", pngData, "gif", "", ErrUnsupportedFormat},
+		{"not an image", []byte("definitely not an image"), "", "", ErrInvalidImage},
+		{"magic bytes only", pngMagic, "", "", ErrInvalidImage},
+		{"truncated png", pngData[:len(pngData)/2], "", "", ErrInvalidImage},
+		{"truncated jpeg", jpegData[:len(jpegData)/2], "", "", ErrInvalidImage},
+		{"empty", nil, "", "", ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := testImageService(t)
+			img, err := is.SaveImageFromReader(bytes.NewReader(tt.data), tt.format)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				if entries, _ := os.ReadDir(is.uploadDir); len(entries) != 0 {
+					t.Errorf("rejected upload left %d files behind", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if img.Format != tt.want || img.Width != 4 || img.Height != 3 {
+				t.Errorf("got %s %dx%d, want %s 4x3", img.Format, img.Width, img.Height, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveImageFromReaderLimits(t *testing.T) {
+	is := testImageService(t)
+	is.maxFileSize = 64
+	if _, err := is.SaveImageFromReader(bytes.NewReader(encodePNG(t)), ""); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("oversized body: error = %v, want ErrFileTooLarge", err)
+	}
+
+	is = testImageService(t)
+	is.maxPixelWidth = 2
+	if _, err := is.SaveImageFromReader(bytes.NewReader(encodePNG(t)), ""); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("oversized dimensions: error = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestSaveImageFromBase64(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(encodePNG(t))
+
+	is := testImageService(t)
+	if _, err := is.SaveImageFromBase64("data:image/png;base64,"+encoded, ""); err != nil {
+		t.Errorf("data URL: unexpected error %v", err)
+	}
+	if _, err := is.SaveImageFromBase64(encoded[:40]+"*!"+encoded[42:], ""); !errors.Is(err, ErrInvalidBase64) {
+		t.Errorf("corrupt base64: error = %v, want ErrInvalidBase64", err)
+	}
+}
+
+func TestValidateImageSize(t *testing.T) {
+	is := testImageService(t)
+	is.maxFileSize = 10
+
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"at limit", base64.StdEncoding.EncodeToString(make([]byte, 10)), true},
+		{"over limit", base64.StdEncoding.EncodeToString(make([]byte, 11)), false},
+		{"data url at limit", "data:image/png;base64," + base64.StdEncoding.EncodeToString(make([]byte, 10)), true},
+		// Content is not checked here; it is rejected while saving
+		{"not base64", "!!!!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := is.ValidateImageSize(tt.data)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrFileTooLarge) {
+				t.Errorf("error = %v, want ErrFileTooLarge", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrQueueFull is returned when no more jobs can be accepted
+var ErrQueueFull = errors.New("processing queue is full, please retry later")
+
+// MakeupJob is a unit of work picked up by the worker pool
+type MakeupJob struct {
+	ImagePath string
+	Options   ApplyOptions
+}
+
+// JobQueue runs makeup applications on a bounded pool of workers
+type JobQueue struct {
+	makeupService *MakeupService
+	imageService  *ImageService
+	results       repository.ResultRepository
+	jobs          chan MakeupJob
+}
+
+func NewJobQueue(makeupService *MakeupService, imageService *ImageService, results repository.ResultRepository, workers int, queueSize int) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	queue := &JobQueue{
+		makeupService: makeupService,
+		imageService:  imageService,
+		results:       results,
+		jobs:          make(chan MakeupJob, queueSize),
+	}
+
+	queue.failInterrupted()
+
+	for i := 0; i < workers; i++ {
+		go queue.worker()
+	}
+
+	return queue
+}
+
+// Enqueue registers a new result in processing state and schedules the job.
+// The result ID is assigned here and overrides opts.ResultID. It never
+// blocks: ErrQueueFull is returned when the backlog is saturated, and the
+// result is discarded since no ID is handed out for it.
+func (q *JobQueue) Enqueue(imageID, imagePath string, opts ApplyOptions) (models.ProcessingResult, error) {
+	opts.ResultID = uuid.New().String()
+	result := models.ProcessingResult{
+		ID:         opts.ResultID,
+		OriginalID: imageID,
+		StyleID:    opts.StyleID,
+		Status:     models.StatusProcessing,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := q.results.Save(result); err != nil {
+		return models.ProcessingResult{}, fmt.Errorf("failed to store result: %v", err)
+	}
+
+	job := MakeupJob{
+		ImagePath: imagePath,
+		Options:   opts,
+	}
+
+	select {
+	case q.jobs <- job:
+		return result, nil
+	default:
+		if err := q.results.Delete(result.ID); err != nil {
+			log.Printf("Failed to discard result %s: %v", result.ID, err)
+		}
+		return models.ProcessingResult{}, ErrQueueFull
+	}
+}
+
+// failInterrupted marks results that were still processing when the server
+// last stopped as failed, since their jobs only lived in memory.
+func (q *JobQueue) failInterrupted() {
+	stale, err := q.results.ListByStatus(models.StatusProcessing)
+	if err != nil {
+		log.Printf("Failed to list interrupted results: %v", err)
+		return
+	}
+
+	for _, result := range stale {
+		result.Status = models.StatusFailed
+		result.Error = "processing was interrupted by a server restart"
+		result.CompletedAt = time.Now()
+		q.save(result)
+	}
+}
+
+func (q *JobQueue) worker() {
+	for job := range q.jobs {
+		q.process(job)
+	}
+}
+
+func (q *JobQueue) process(job MakeupJob) {
+	result, err := q.results.Get(job.Options.ResultID)
+	if err != nil {
+		log.Printf("Makeup job %s has no stored result: %v", job.Options.ResultID, err)
+		return
+	}
+
+	applied, err := q.run(job)
+	result.CompletedAt = time.Now()
+	result.Faces = applied.Faces
+	result.Quality = applied.Quality
+	result.LandmarksEstimated = applied.LandmarksEstimated
+	if err != nil {
+		log.Printf("Makeup job %s failed: %v", job.Options.ResultID, err)
+		result.Status = models.StatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = models.StatusCompleted
+		result.ResultURL = q.imageService.GetImageURL(applied.Path)
+	}
+
+	q.save(result)
+}
+
+// run applies the style and turns a panic inside the image pipeline into a
+// failed result instead of taking the worker down.
+func (q *JobQueue) run(job MakeupJob) (applied ApplyResult, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("makeup processing panicked: %v", recovered)
+		}
+	}()
+
+	return q.makeupService.ApplyMakeupStyle(job.ImagePath, job.Options)
+}
+
+func (q *JobQueue) save(result models.ProcessingResult) {
+	if err := q.results.Save(result); err != nil {
+		log.Printf("Failed to store result %s: %v", result.ID, err)
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func newTestResultRepository(t *testing.T) *repository.BoltResultRepository {
+	t.Helper()
+	db, err := repository.OpenDB(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	results, err := repository.NewBoltResultRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// panickingFaceDetector blows up inside the image pipeline
+type panickingFaceDetector struct {
+	FakeFaceDetector
+}
+
+func (d *panickingFaceDetector) Detect(img gocv.Mat) ([]image.Rectangle, error) {
+	panic("detector crashed")
+}
+
+// waitForResult polls until the job of id has finished
+func waitForResult(t *testing.T, results repository.ResultRepository, id string) models.ProcessingResult {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		result, err := results.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != models.StatusProcessing {
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("result %s is still processing", id)
+	return models.ProcessingResult{}
+}
+
+func TestJobQueueCompletes(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+	results := newTestResultRepository(t)
+	ms := newTestMakeupService(t, &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(100, 50, 260, 250)}}, QualityConfig{})
+	queue := NewJobQueue(ms, testImageService(t), results, 1, 4)
+
+	queued, err := queue.Enqueue("image-1", photo, ApplyOptions{StyleID: testStyle.ID, ResultID: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.ID == "" || queued.ID == "ignored" || queued.Status != models.StatusProcessing {
+		t.Fatalf("queued result = %+v, want a fresh ID in processing state", queued)
+	}
+
+	result := waitForResult(t, results, queued.ID)
+	if result.Status != models.StatusCompleted || result.Error != "" {
+		t.Fatalf("result = %+v, want completed", result)
+	}
+	if result.OriginalID != "image-1" || result.StyleID != testStyle.ID || result.ResultURL == "" {
+		t.Errorf("result = %+v, want the image, style and result URL recorded", result)
+	}
+	if len(result.Faces) != 1 || !result.Faces[0].Processed || !result.LandmarksEstimated {
+		t.Errorf("result faces = %+v, estimated = %v", result.Faces, result.LandmarksEstimated)
+	}
+}
+
+func TestJobQueueFailures(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+
+	tests := []struct {
+		name     string
+		detector FaceDetector
+		styleID  string
+		wantErr  string
+	}{
+		{"unknown style", &FakeFaceDetector{}, "missing", "style missing not found"},
+		{"no faces", &FakeFaceDetector{}, testStyle.ID, "no faces detected"},
+		{"worker panic", &panickingFaceDetector{}, testStyle.ID, "makeup processing panicked: detector crashed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := newTestResultRepository(t)
+			queue := NewJobQueue(newTestMakeupService(t, tt.detector, QualityConfig{}), testImageService(t), results, 1, 4)
+
+			queued, err := queue.Enqueue("image-1", photo, ApplyOptions{StyleID: tt.styleID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := waitForResult(t, results, queued.ID)
+			if result.Status != models.StatusFailed || !strings.Contains(result.Error, tt.wantErr) {
+				t.Errorf("result = %s %q, want failed with %q", result.Status, result.Error, tt.wantErr)
+			}
+			if result.ResultURL != "" || result.CompletedAt.IsZero() {
+				t.Errorf("failed result = %+v", result)
+			}
+
+			// The worker survives a failed job and picks up the next one
+			next, err := queue.Enqueue("image-2", photo, ApplyOptions{StyleID: "missing"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := waitForResult(t, results, next.ID); result.Status != models.StatusFailed {
+				t.Errorf("next result = %+v, want failed", result)
+			}
+		})
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	results := newTestResultRepository(t)
+	// No workers, so the single slot stays taken
+	queue := &JobQueue{results: results, jobs: make(chan MakeupJob, 1)}
+
+	first, err := queue.Enqueue("image-1", "photo.png", ApplyOptions{StyleID: testStyle.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := queue.Enqueue("image-2", "photo.png", ApplyOptions{StyleID: testStyle.ID})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("error = %v, want ErrQueueFull", err)
+	}
+	if rejected.ID != "" {
+		t.Errorf("rejected job was given result ID %s", rejected.ID)
+	}
+
+	processing, err := results.ListByStatus(models.StatusProcessing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processing) != 1 || processing[0].ID != first.ID {
+		t.Errorf("processing results = %+v, want only %s", processing, first.ID)
+	}
+}
+
+func TestJobQueueFailsInterruptedJobs(t *testing.T) {
+	results := newTestResultRepository(t)
+	stored := []models.ProcessingResult{
+		{ID: "interrupted", Status: models.StatusProcessing},
+		{ID: "done", Status: models.StatusCompleted, ResultURL: "/uploads/results/done.jpg"},
+	}
+	for _, result := range stored {
+		if err := results.Save(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	NewJobQueue(newTestMakeupService(t, &FakeFaceDetector{}, QualityConfig{}), testImageService(t), results, 1, 1)
+
+	interrupted, err := results.Get("interrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted.Status != models.StatusFailed || !strings.Contains(interrupted.Error, "restart") || interrupted.CompletedAt.IsZero() {
+		t.Errorf("interrupted result = %+v, want failed by the restart", interrupted)
+	}
+	done, err := results.Get("done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != models.StatusCompleted || done.Error != "" {
+		t.Errorf("completed result = %+v, want it untouched", done)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// landmarkCount is the number of points in the iBUG 300-W layout
+const landmarkCount = 68
+
+// FaceLandmarks holds the 68 iBUG 300-W facial points in image coordinates.
+// Left and right are from the subject's point of view, so the right eye is
+// on the left side of the image.
+type FaceLandmarks struct {
+	Points []image.Point `json:"points"`
+	// Estimated is set when the points are a fitted average shape rather
+	// than measured on this face
+	Estimated bool `json:"estimated"`
+}
+
+// LandmarkDetector locates facial landmarks inside a detected face box.
+// Implementations must be safe for concurrent use.
+type LandmarkDetector interface {
+	Detect(img gocv.Mat, face image.Rectangle) (FaceLandmarks, error)
+	Status() DetectorStatus
+}
+
+func (l FaceLandmarks) span(from, to int) []image.Point {
+	return append([]image.Point(nil), l.Points[from:to]...)
+}
+
+func (l FaceLandmarks) pick(indexes ...int) []image.Point {
+	points := make([]image.Point, len(indexes))
+	for i, idx := range indexes {
+		points[i] = l.Points[idx]
+	}
+	return points
+}
+
+// Jawline runs from the right ear, round the chin, to the left ear
+func (l FaceLandmarks) Jawline() []image.Point { return l.span(0, 17) }
+
+func (l FaceLandmarks) RightBrow() []image.Point { return l.span(17, 22) }
+
+func (l FaceLandmarks) LeftBrow() []image.Point { return l.span(22, 27) }
+
+// NoseBridge runs from between the eyes down to the tip
+func (l FaceLandmarks) NoseBridge() []image.Point { return l.span(27, 31) }
+
+// NoseBase runs across the nostrils
+func (l FaceLandmarks) NoseBase() []image.Point { return l.span(31, 36) }
+
+func (l FaceLandmarks) RightEye() []image.Point { return l.span(36, 42) }
+
+func (l FaceLandmarks) LeftEye() []image.Point { return l.span(42, 48) }
+
+// OuterLips is the outer lip contour, starting at the right mouth corner
+func (l FaceLandmarks) OuterLips() []image.Point { return l.span(48, 60) }
+
+// InnerLips is the mouth opening between the lips
+func (l FaceLandmarks) InnerLips() []image.Point { return l.span(60, 68) }
+
+// RightCheek spans from under the right eye to the jaw, outside the nose and mouth
+func (l FaceLandmarks) RightCheek() []image.Point {
+	return l.pick(1, 2, 3, 4, 48, 31, 40, 41, 36)
+}
+
+// LeftCheek mirrors RightCheek
+func (l FaceLandmarks) LeftCheek() []image.Point {
+	return l.pick(15, 14, 13, 12, 54, 35, 47, 46, 45)
+}
+
+// FaceOutline closes the jawline over the forehead by lifting the brows by
+// the brow-to-nose-tip distance, which approximates the hairline.
+func (l FaceLandmarks) FaceOutline() []image.Point {
+	outline := l.Jawline()
+	lift := l.Points[30].Y - l.Points[27].Y
+	for i := 26; i >= 17; i-- {
+		p := l.Points[i]
+		outline = append(outline, image.Pt(p.X, p.Y-lift))
+	}
+	return outline
+}
+
+// EyeArea covers an eye together with its lid, stopping a third of the way
+// below the brow. It walks the lower lash line and returns along the brow.
+func (l FaceLandmarks) EyeArea(eye []image.Point, brow []image.Point) []image.Point {
+	area := []image.Point{eye[3], eye[4], eye[5], eye[0]}
+	for _, p := range brow {
+		area = append(area, image.Pt(p.X, p.Y+(eye[1].Y-p.Y)/3))
+	}
+	return area
+}
+
+// JawBand is a strip along the jawline reaching depth (a fraction of the
+// distance to the nose tip) into the face.
+func (l FaceLandmarks) JawBand(depth float64) []image.Point {
+	jaw := l.Jawline()
+	tip := l.Points[30]
+	band := append([]image.Point(nil), jaw...)
+	for i := len(jaw) - 1; i >= 0; i-- {
+		p := jaw[i]
+		band = append(band, image.Pt(
+			p.X+int(float64(tip.X-p.X)*depth),
+			p.Y+int(float64(tip.Y-p.Y)*depth),
+		))
+	}
+	return band
+}
+
+// NoseBridgeArea widens the nose bridge line into a narrow strip
+func (l FaceLandmarks) NoseBridgeArea() []image.Point {
+	half := (l.Points[39].X - l.Points[36].X) / 6
+	if half < 1 {
+		half = 1
+	}
+	bridge := l.NoseBridge()
+	area := make([]image.Point, 0, len(bridge)*2)
+	for _, p := range bridge {
+		area = append(area, image.Pt(p.X-half, p.Y))
+	}
+	for i := len(bridge) - 1; i >= 0; i-- {
+		area = append(area, image.Pt(bridge[i].X+half, bridge[i].Y))
+	}
+	return area
+}
+
+// Center is the midpoint between the eyes
+func (l FaceLandmarks) Center() image.Point {
+	return l.Points[27]
+}
+
+// Bounds is the bounding box of all points
+func (l FaceLandmarks) Bounds() image.Rectangle {
+	return polygonBounds(l.Points)
+}
+
+// meanShape is an average frontal face in coordinates normalised to a Haar
+// or DNN face box, used when no landmark model is configured.
+var meanShape = [landmarkCount][2]float64{
+	// jaw 0-16
+	{0.080, 0.320}, {0.088, 0.449}, {0.112, 0.573}, {0.151, 0.687}, {0.203, 0.787},
+	{0.267, 0.869}, {0.339, 0.930}, {0.418, 0.967}, {0.500, 0.980}, {0.582, 0.967},
+	{0.661, 0.930}, {0.733, 0.869}, {0.797, 0.787}, {0.849, 0.687}, {0.888, 0.573},
+	{0.912, 0.449}, {0.920, 0.320},
+	// right brow 17-21, left brow 22-26
+	{0.170, 0.270}, {0.235, 0.235}, {0.300, 0.220}, {0.365, 0.235}, {0.430, 0.270},
+	{0.570, 0.270}, {0.635, 0.235}, {0.700, 0.220}, {0.765, 0.235}, {0.830, 0.270},
+	// nose bridge 27-30, nose base 31-35
+	{0.500, 0.360}, {0.500, 0.440}, {0.500, 0.520}, {0.500, 0.600},
+	{0.420, 0.660}, {0.460, 0.670}, {0.500, 0.680}, {0.540, 0.670}, {0.580, 0.660},
+	// right eye 36-41, left eye 42-47
+	{0.220, 0.380}, {0.280, 0.345}, {0.340, 0.345}, {0.400, 0.380}, {0.340, 0.410}, {0.280, 0.410},
+	{0.600, 0.380}, {0.660, 0.345}, {0.720, 0.345}, {0.780, 0.380}, {0.720, 0.410}, {0.660, 0.410},
+	// outer lips 48-59
+	{0.360, 0.800}, {0.410, 0.775}, {0.460, 0.765}, {0.500, 0.770}, {0.540, 0.765}, {0.590, 0.775},
+	{0.640, 0.800}, {0.590, 0.845}, {0.540, 0.870}, {0.500, 0.875}, {0.460, 0.870}, {0.410, 0.845},
+	// inner lips 60-67
+	{0.380, 0.800}, {0.450, 0.795}, {0.500, 0.800}, {0.550, 0.795},
+	{0.620, 0.800}, {0.550, 0.815}, {0.500, 0.820}, {0.450, 0.815},
+}
+
+// MeanShapeLandmarkDetector places the average face shape in the face box.
+// It needs no model file but ignores pose and expression.
+type MeanShapeLandmarkDetector struct{}
+
+func NewMeanShapeLandmarkDetector() *MeanShapeLandmarkDetector {
+	return &MeanShapeLandmarkDetector{}
+}
+
+func (d *MeanShapeLandmarkDetector) Detect(img gocv.Mat, face image.Rectangle) (FaceLandmarks, error) {
+	points := make([]image.Point, landmarkCount)
+	for i, p := range meanShape {
+		points[i] = image.Pt(
+			face.Min.X+int(p[0]*float64(face.Dx())),
+			face.Min.Y+int(p[1]*float64(face.Dy())),
+		)
+	}
+	return FaceLandmarks{Points: points, Estimated: true}, nil
+}
+
+func (d *MeanShapeLandmarkDetector) Status() DetectorStatus {
+	return DetectorStatus{Backend: "mean-shape", Estimated: true}
+}
+
+// DNNLandmarkDetector regresses the 68 points with a local ONNX model (for
+// example PFLD) that takes a square RGB face crop and outputs 136 values
+// normalised to the crop.
+type DNNLandmarkDetector struct {
+	nets      *modelPool[gocv.Net]
+	inputSize int
+}
+
+func NewDNNLandmarkDetector(modelPath string, inputSize int, poolSize int) (*DNNLandmarkDetector, error) {
+	nets, err := newModelPool(poolSize, func() (gocv.Net, error) {
+		return loadNet(modelPath, "")
+	}, func(net gocv.Net) { net.Close() })
+	if err != nil {
+		return nil, fmt.Errorf("failed to load landmark model: %v", err)
+	}
+
+	if inputSize <= 0 {
+		inputSize = 112
+	}
+	return &DNNLandmarkDetector{nets: nets, inputSize: inputSize}, nil
+}
+
+func (d *DNNLandmarkDetector) Detect(img gocv.Mat, face image.Rectangle) (FaceLandmarks, error) {
+	// Landmark models are trained on square crops slightly larger than the face
+	crop := squareAround(face, 1.1).Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if crop.Empty() {
+		return FaceLandmarks{}, fmt.Errorf("face box lies outside the image")
+	}
+
+	region := img.Region(crop)
+	defer region.Close()
+
+	size := image.Pt(d.inputSize, d.inputSize)
+	blob := gocv.BlobFromImage(region, 1.0/255.0, size, gocv.NewScalar(0, 0, 0, 0), true, false)
+	defer blob.Close()
+
+	var values []float32
+	err := d.nets.with(func(net gocv.Net) error {
+		net.SetInput(blob, "")
+		output := net.Forward("")
+		defer output.Close()
+
+		data, err := output.DataPtrFloat32()
+		if err != nil {
+			return fmt.Errorf("failed to read landmark output: %v", err)
+		}
+		// Copy out before the output mat is freed
+		values = append([]float32(nil), data...)
+		return nil
+	})
+	if err != nil {
+		return FaceLandmarks{}, err
+	}
+	if len(values) < landmarkCount*2 {
+		return FaceLandmarks{}, fmt.Errorf("landmark model returned %d values, want %d", len(values), landmarkCount*2)
+	}
+
+	points := make([]image.Point, landmarkCount)
+	for i := range points {
+		points[i] = image.Pt(
+			crop.Min.X+int(float64(values[2*i])*float64(crop.Dx())),
+			crop.Min.Y+int(float64(values[2*i+1])*float64(crop.Dy())),
+		)
+	}
+	return FaceLandmarks{Points: points}, nil
+}
+
+func (d *DNNLandmarkDetector) Status() DetectorStatus {
+	return d.nets.status("dnn")
+}
+
+// squareAround returns a square of side scale*max(w, h) centred on r
+func squareAround(r image.Rectangle, scale float64) image.Rectangle {
+	side := r.Dx()
+	if r.Dy() > side {
+		side = r.Dy()
+	}
+	half := int(float64(side) * scale / 2)
+	cx := (r.Min.X + r.Max.X) / 2
+	cy := (r.Min.Y + r.Max.Y) / 2
+	return image.Rect(cx-half, cy-half, cx+half, cy+half)
+}
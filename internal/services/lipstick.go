@@ -0,0 +1,142 @@
+package services
+
+import (
+	"image"
+	"makeup-api/internal/models"
+
+	"gocv.io/x/gocv"
+)
+
+// lipCoverage is how far lipstick moves the lips' own lightness towards the
+// shade; the rest is left so dark or pale lips still read naturally.
+const lipCoverage = 0.7
+
+// lipRegion segments the lips. The landmark lip polygon is widened slightly
+// to absorb landmark error, then each pixel is weighted by how much redder
+// it is than the surrounding skin, which trims skin and teeth off the edges.
+func lipRegion(img gocv.Mat, lm FaceLandmarks) (*regionMask, bool) {
+	outer := lm.OuterLips()
+	inner := lm.InnerLips()
+
+	rect := polygonBounds(scalePolygon(outer, 1.6)).Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil, false
+	}
+
+	search := polygonMask(rect, [][]image.Point{scalePolygon(outer, 1.15)}, [][]image.Point{scalePolygon(inner, 0.9)})
+	core := polygonMask(rect, [][]image.Point{scalePolygon(outer, 0.9)}, [][]image.Point{scalePolygon(inner, 1.2)})
+	defer core.Close()
+	ring := polygonMask(rect, [][]image.Point{scalePolygon(outer, 1.6)}, [][]image.Point{scalePolygon(outer, 1.25)})
+	defer ring.Close()
+
+	region := &regionMask{rect: rect, mask: search}
+	source := region.source(img)
+	defer source.Close()
+	gocv.CvtColor(source, &source, gocv.ColorBGRToLab)
+
+	lab, errLab := source.DataPtrUint8()
+	weights, errMask := search.DataPtrUint8()
+	coreWeights, errCore := core.DataPtrUint8()
+	ringWeights, errRing := ring.DataPtrUint8()
+	if errLab == nil && errMask == nil && errCore == nil && errRing == nil {
+		lips, okLips := meanLab(lab, coreWeights)
+		skin, okSkin := meanLab(lab, ringWeights)
+		// Only refine when the lips are distinguishable from the skin
+		if okLips && okSkin && lips.A-skin.A > 4 {
+			for i, weight := range weights {
+				if weight == 0 {
+					continue
+				}
+				likelihood := (float64(lab[i*3+1]) - skin.A) / (lips.A - skin.A)
+				weights[i] = clampUint8(float64(weight) * clamp01(likelihood*1.5))
+			}
+		}
+	}
+
+	featherMask(&region.mask, featherRadius(lm, 0.01))
+	return region, true
+}
+
+// renderLipstick recolours the lips in Lab space. The lipstick sets the
+// chroma outright while the lips' own lightness variation is kept, so lip
+// lines and natural highlights survive; the finish then shapes that
+// variation.
+func (ms *MakeupService) renderLipstick(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+	finish := paramString(layer, "finish", models.FinishSatin)
+
+	region, ok := lipRegion(*img, lm)
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	gocv.CvtColor(overlay, &overlay, gocv.ColorBGRToLab)
+
+	lab, err := overlay.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	weights, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	current, ok := meanLab(lab, weights)
+	if !ok {
+		return
+	}
+
+	target := toLab(shade)
+	baseL := current.L + (target.L-current.L)*lipCoverage
+	width := region.rect.Dx()
+
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		deviation := float64(lab[i*3]) - current.L
+
+		switch finish {
+		case models.FinishMatte:
+			// Flatten sheen and soften highlights
+			deviation *= 0.5
+			if deviation > 0 {
+				deviation *= 0.5
+			}
+		case models.FinishGloss:
+			// Exaggerate the natural highlights into a wet shine
+			if deviation > 0 {
+				deviation *= 2.2
+			}
+		case models.FinishMetallic:
+			// Stronger light/dark play plus fine sparkle
+			deviation *= 1.4
+			x, y := i%width+region.rect.Min.X, i/width+region.rect.Min.Y
+			if noise := pixelNoise(x, y); noise > 0.96 {
+				deviation += 60 * (noise - 0.96) / 0.04
+			}
+		}
+
+		lab[i*3] = clampUint8(baseL + deviation)
+		lab[i*3+1] = clampUint8(target.A)
+		lab[i*3+2] = clampUint8(target.B)
+	}
+
+	gocv.CvtColor(overlay, &overlay, gocv.ColorLabToBGR)
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
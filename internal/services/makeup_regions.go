@@ -0,0 +1,175 @@
+package services
+
+import (
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+// regionMask is a feathered single-channel mask over part of an image. Only
+// the bounding rectangle of the region is stored, and overlays passed to
+// blend are expected in the same rectangle-local coordinates.
+type regionMask struct {
+	rect image.Rectangle // in image coordinates
+	mask gocv.Mat        // CV8UC1, rect sized, 255 = fully inside
+}
+
+// newRegionMask rasterises the include polygons, clears the exclude
+// polygons and softens the edge with a Gaussian of the feather radius. It
+// reports false when the region falls entirely outside the image.
+func newRegionMask(img gocv.Mat, include, exclude [][]image.Point, feather int) (*regionMask, bool) {
+	if feather < 1 {
+		feather = 1
+	}
+
+	var bounds image.Rectangle
+	for _, polygon := range include {
+		bounds = bounds.Union(polygonBounds(polygon))
+	}
+	rect := bounds.Inset(-2 * feather).Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil, false
+	}
+
+	mask := polygonMask(rect, include, exclude)
+	featherMask(&mask, feather)
+
+	return &regionMask{rect: rect, mask: mask}, true
+}
+
+// polygonMask rasterises polygons given in image coordinates into a hard
+// rect-sized mask.
+func polygonMask(rect image.Rectangle, include, exclude [][]image.Point) gocv.Mat {
+	mask := gocv.NewMatWithSize(rect.Dy(), rect.Dx(), gocv.MatTypeCV8UC1)
+	mask.SetTo(gocv.NewScalar(0, 0, 0, 0))
+	fillPolygons(&mask, include, rect.Min, color.RGBA{255, 255, 255, 255})
+	fillPolygons(&mask, exclude, rect.Min, color.RGBA{0, 0, 0, 0})
+	return mask
+}
+
+// featherMask softens mask edges with a Gaussian of the given radius
+func featherMask(mask *gocv.Mat, feather int) {
+	kernel := feather*2 + 1
+	gocv.GaussianBlur(*mask, mask, image.Pt(kernel, kernel), 0, 0, gocv.BorderDefault)
+}
+
+func (r *regionMask) Close() {
+	r.mask.Close()
+}
+
+// source returns a continuous copy of the image pixels under the mask
+func (r *regionMask) source(img gocv.Mat) gocv.Mat {
+	region := img.Region(r.rect)
+	defer region.Close()
+	return region.Clone()
+}
+
+// solid returns a rect-sized overlay filled with c
+func (r *regionMask) solid(c color.RGBA) gocv.Mat {
+	return gocv.NewMatWithSizeFromScalar(
+		gocv.NewScalar(float64(c.B), float64(c.G), float64(c.R), 0),
+		r.rect.Dy(), r.rect.Dx(), gocv.MatTypeCV8UC3,
+	)
+}
+
+// blend composites a rect-sized BGR overlay onto img, weighting each pixel
+// by opacity times the mask value.
+func (r *regionMask) blend(img *gocv.Mat, overlay gocv.Mat, opacity float64) {
+	dst, err := img.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	src, err := overlay.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	weights, err := r.mask.DataPtrUint8()
+	if err != nil {
+		return
+	}
+
+	stride := img.Cols() * 3
+	width := r.rect.Dx()
+	for y := 0; y < r.rect.Dy(); y++ {
+		row := (r.rect.Min.Y+y)*stride + r.rect.Min.X*3
+		for x := 0; x < width; x++ {
+			alpha := opacity * float64(weights[y*width+x]) / 255
+			if alpha <= 0 {
+				continue
+			}
+			d := row + x*3
+			s := (y*width + x) * 3
+			for ch := 0; ch < 3; ch++ {
+				dst[d+ch] = clampUint8(float64(dst[d+ch])*(1-alpha) + float64(src[s+ch])*alpha)
+			}
+		}
+	}
+}
+
+// fillPolygons draws polygons given in image coordinates onto a mask whose
+// origin is at offset.
+func fillPolygons(mask *gocv.Mat, polygons [][]image.Point, offset image.Point, c color.RGBA) {
+	if len(polygons) == 0 {
+		return
+	}
+
+	local := make([][]image.Point, len(polygons))
+	for i, polygon := range polygons {
+		local[i] = make([]image.Point, len(polygon))
+		for j, p := range polygon {
+			local[i][j] = p.Sub(offset)
+		}
+	}
+
+	points := gocv.NewPointsVectorFromPoints(local)
+	defer points.Close()
+	gocv.FillPoly(mask, points, c)
+}
+
+func polygonBounds(points []image.Point) image.Rectangle {
+	if len(points) == 0 {
+		return image.Rectangle{}
+	}
+	bounds := image.Rectangle{Min: points[0], Max: points[0].Add(image.Pt(1, 1))}
+	for _, p := range points[1:] {
+		bounds = bounds.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+	}
+	return bounds
+}
+
+// scalePolygon grows or shrinks a polygon about its centroid
+func scalePolygon(points []image.Point, scale float64) []image.Point {
+	var cx, cy float64
+	for _, p := range points {
+		cx += float64(p.X)
+		cy += float64(p.Y)
+	}
+	cx /= float64(len(points))
+	cy /= float64(len(points))
+
+	scaled := make([]image.Point, len(points))
+	for i, p := range points {
+		scaled[i] = image.Pt(
+			int(cx+(float64(p.X)-cx)*scale),
+			int(cy+(float64(p.Y)-cy)*scale),
+		)
+	}
+	return scaled
+}
+
+// featherRadius scales a feather to the face size so edges look the same
+// on small and large faces.
+func featherRadius(lm FaceLandmarks, fraction float64) int {
+	return int(float64(lm.Bounds().Dx())*fraction) + 1
+}
+
+func clampUint8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// testStyle paints both cheeks solid blue so applied makeup is easy to spot
+var testStyle = models.MakeupStyle{
+	ID:        "test",
+	Name:      "Test",
+	Intensity: 5,
+	Layers: []models.EffectLayer{
+		{Type: models.LayerTint, Region: models.RegionCheeks, Color: "#0000FF", Opacity: 1},
+	},
+}
+
+// newTestMakeupService builds a MakeupService over faces, with mean-shape
+// landmarks and a style store holding testStyle
+func newTestMakeupService(t *testing.T, faces FaceDetector, quality QualityConfig) *MakeupService {
+	t.Helper()
+
+	db, err := repository.OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := repository.NewBoltStyleRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Seed([]models.MakeupStyle{testStyle}); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := NewMakeupService(faces, NewMeanShapeLandmarkDetector(), quality, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+// chdirTemp runs the test in an empty directory, since results are written
+// under the working directory
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// writeTestPhoto saves a skin-coloured PNG with a little texture
+func writeTestPhoto(t *testing.T, width, height int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			shade := uint8((x*7 + y*13) % 16)
+			img.Set(x, y, color.RGBA{200 + shade, 160 + shade, 135 + shade, 255})
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "photo.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readTestImage(t *testing.T, path string) image.Image {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// changedPixels counts the pixels inside rect that differ between a and b
+func changedPixels(a, b image.Image, rect image.Rectangle) int {
+	changed := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestApplyMakeupStyleSelectsFaces(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+
+	// Listed right to left; faces are indexed left to right
+	left := image.Rect(30, 60, 170, 220) // largest
+	right := image.Rect(240, 80, 360, 220)
+	detector := &FakeFaceDetector{Faces: []image.Rectangle{right, left}}
+
+	tests := []struct {
+		name string
+		sel  FaceSelection
+		want []bool // processed, by face index
+	}{
+		{"largest", FaceSelection{Mode: FaceSelectLargest}, []bool{true, false}},
+		{"all", FaceSelection{Mode: FaceSelectAll}, []bool{true, true}},
+		{"index", FaceSelection{Mode: FaceSelectIndex, Index: 1}, []bool{false, true}},
+		{"box", FaceSelection{Mode: FaceSelectBox, Box: image.Rect(250, 90, 350, 210)}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newTestMakeupService(t, detector, QualityConfig{})
+			result, err := ms.ApplyMakeupStyle(photo, ApplyOptions{
+				StyleID:      testStyle.ID,
+				ResultID:     tt.name,
+				OutputFormat: FormatPNG,
+				Faces:        tt.sel,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Faces) != 2 {
+				t.Fatalf("got %d faces, want 2", len(result.Faces))
+			}
+
+			original := readTestImage(t, photo)
+			made := readTestImage(t, result.Path)
+			for i, box := range []image.Rectangle{left, right} {
+				if result.Faces[i].Box != toFaceBox(box) {
+					t.Errorf("face %d box = %+v, want %+v", i, result.Faces[i].Box, toFaceBox(box))
+				}
+				if result.Faces[i].Processed != tt.want[i] {
+					t.Errorf("face %d processed = %v, want %v", i, result.Faces[i].Processed, tt.want[i])
+				}
+				if changed := changedPixels(original, made, box) > 0; changed != tt.want[i] {
+					t.Errorf("face %d pixels changed = %v, want %v", i, changed, tt.want[i])
+				}
+			}
+			if !result.LandmarksEstimated {
+				t.Errorf("LandmarksEstimated = false with mean-shape landmarks")
+			}
+		})
+	}
+}
+
+func TestApplyMakeupStyleFailures(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+	detectorErr := errors.New("model exploded")
+
+	tests := []struct {
+		name     string
+		detector *FakeFaceDetector
+		opts     ApplyOptions
+		wantErr  error
+	}{
+		{
+			name:     "no faces",
+			detector: &FakeFaceDetector{},
+			opts:     ApplyOptions{StyleID: testStyle.ID, ResultID: "none"},
+			wantErr:  ErrPoorQuality,
+		},
+		{
+			name:     "detector error",
+			detector: &FakeFaceDetector{Err: detectorErr},
+			opts:     ApplyOptions{StyleID: testStyle.ID, ResultID: "error"},
+		},
+		{
+			name:     "face index out of range",
+			detector: &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(100, 50, 260, 250)}},
+			opts:     ApplyOptions{StyleID: testStyle.ID, ResultID: "range", Faces: FaceSelection{Mode: FaceSelectIndex, Index: 1}},
+		},
+		{
+			name:     "unknown style",
+			detector: &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(100, 50, 260, 250)}},
+			opts:     ApplyOptions{StyleID: "missing", ResultID: "style"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newTestMakeupService(t, tt.detector, QualityConfig{})
+			result, err := ms.ApplyMakeupStyle(photo, tt.opts)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if result.Path != "" {
+				t.Errorf("failed application wrote %s", result.Path)
+			}
+		})
+	}
+}
+
+func TestApplyMakeupStyleEnforcesQuality(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+
+	// A tiny face in the corner of a flat photo has blocking issues
+	detector := &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(0, 0, 20, 20)}}
+	ms := newTestMakeupService(t, detector, QualityConfig{Enforce: true})
+
+	result, err := ms.ApplyMakeupStyle(photo, ApplyOptions{StyleID: testStyle.ID, ResultID: "poor"})
+	if !errors.Is(err, ErrPoorQuality) {
+		t.Fatalf("error = %v, want ErrPoorQuality", err)
+	}
+	if result.Quality == nil || result.Quality.Acceptable {
+		t.Errorf("quality report = %+v, want an unacceptable report", result.Quality)
+	}
+}
+
+// countingLandmarkDetector counts landmark detections
+type countingLandmarkDetector struct {
+	LandmarkDetector
+	calls int
+}
+
+func (d *countingLandmarkDetector) Detect(img gocv.Mat, face image.Rectangle) (FaceLandmarks, error) {
+	d.calls++
+	return d.LandmarkDetector.Detect(img, face)
+}
+
+func TestApplyMakeupStyleDetectsLandmarksOnce(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+	detector := &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(30, 60, 170, 220), image.Rect(240, 80, 360, 220)}}
+
+	ms := newTestMakeupService(t, detector, QualityConfig{})
+	landmarks := &countingLandmarkDetector{LandmarkDetector: ms.landmarks}
+	ms.landmarks = landmarks
+
+	result, err := ms.ApplyMakeupStyle(photo, ApplyOptions{
+		StyleID:  testStyle.ID,
+		ResultID: "once",
+		Faces:    FaceSelection{Mode: FaceSelectAll},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Quality == nil {
+		t.Error("no quality report")
+	}
+	if landmarks.calls != 2 {
+		t.Errorf("landmarks detected %d times for 2 faces, want once per face", landmarks.calls)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+// DetectorStatus reports a detector's backend and how many pooled
+// instances are free right now. Detectors only exist once all their models
+// have loaded, so there is no separate readiness state.
+type DetectorStatus struct {
+	Backend   string `json:"backend"`
+	PoolSize  int    `json:"pool_size"`
+	Available int    `json:"available"`
+	// Estimated is set for landmark detectors that fit an average shape
+	// instead of measuring each face
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// modelPool hands out exclusive use of model instances loaded at startup.
+// OpenCV classifiers and networks are not safe for concurrent use, so each
+// caller borrows one and returns it when done.
+type modelPool[T any] struct {
+	instances chan T
+	size      int
+}
+
+// newModelPool loads size instances up front, releasing any already loaded
+// when one fails.
+func newModelPool[T any](size int, load func() (T, error), release func(T)) (*modelPool[T], error) {
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &modelPool[T]{instances: make(chan T, size), size: size}
+	for i := 0; i < size; i++ {
+		instance, err := load()
+		if err != nil {
+			close(pool.instances)
+			for loaded := range pool.instances {
+				release(loaded)
+			}
+			return nil, err
+		}
+		pool.instances <- instance
+	}
+	return pool, nil
+}
+
+// with runs fn with a borrowed instance, waiting for one to become free.
+// The instance is returned to the pool even if fn panics.
+func (p *modelPool[T]) with(fn func(T) error) error {
+	instance := <-p.instances
+	defer func() { p.instances <- instance }()
+	return fn(instance)
+}
+
+func (p *modelPool[T]) status(backend string) DetectorStatus {
+	return DetectorStatus{
+		Backend:   backend,
+		PoolSize:  p.size,
+		Available: len(p.instances),
+	}
+}
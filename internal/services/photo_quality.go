@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"makeup-api/internal/models"
+	"math"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Quality issue codes reported by the photo pre-check
+const (
+	IssueNoFace       = "no_face"
+	IssueBlurry       = "blurry"
+	IssueUnderexposed = "underexposed"
+	IssueOverexposed  = "overexposed"
+	IssueFaceTooSmall = "face_too_small"
+	IssueFaceCutOff   = "face_cut_off"
+	IssueHeadTurned   = "head_turned"
+	IssueFaceOccluded = "face_occluded"
+	IssueLowContrast  = "low_contrast"
+)
+
+// edgeMarginFraction of the image width around the border counts as the edge
+const edgeMarginFraction = 0.01
+
+// ErrPoorQuality is returned when enforced quality checks reject a photo
+var ErrPoorQuality = errors.New("photo quality too low")
+
+// QualityConfig holds the thresholds of the photo quality pre-check. Zero
+// values select the defaults.
+type QualityConfig struct {
+	MinSharpness    float64 // Laplacian variance
+	MinBrightness   float64 // mean luma, 0-255
+	MaxBrightness   float64
+	MinContrast     float64 // luma standard deviation
+	MaxClipped      float64 // fraction of face pixels clipped to black or white
+	MinFaceRatio    float64 // face area over image area
+	MaxYaw          float64 // degrees
+	MaxPitch        float64
+	MaxRoll         float64
+	MinSkinCoverage float64 // fraction of the inner face
+	// Enforce fails apply jobs whose faces have error-severity issues
+	// instead of only reporting them
+	Enforce bool
+	// CheckOnUpload attaches a quality report to upload responses. It runs
+	// face detection on the upload request itself, so it is off by default.
+	CheckOnUpload bool
+}
+
+func (c QualityConfig) withDefaults() QualityConfig {
+	defaults := []struct {
+		value *float64
+		def   float64
+	}{
+		{&c.MinSharpness, 60},
+		{&c.MinBrightness, 60},
+		{&c.MaxBrightness, 200},
+		{&c.MinContrast, 20},
+		{&c.MaxClipped, 0.25},
+		{&c.MinFaceRatio, 0.02},
+		{&c.MaxYaw, 30},
+		{&c.MaxPitch, 25},
+		{&c.MaxRoll, 20},
+		{&c.MinSkinCoverage, 0.4},
+	}
+	for _, d := range defaults {
+		if *d.value <= 0 {
+			*d.value = d.def
+		}
+	}
+	return c
+}
+
+// evaluate turns the measurements of one face into quality issues
+func (c QualityConfig) evaluate(index int, face, frame image.Rectangle, q models.FaceQuality) []models.QualityIssue {
+	issues := []models.QualityIssue{}
+	add := func(code, severity, message, tip string) {
+		faceIndex := index
+		issues = append(issues, models.QualityIssue{
+			Code:     code,
+			Severity: severity,
+			Message:  message,
+			Tip:      tip,
+			Face:     &faceIndex,
+		})
+	}
+
+	if q.FaceRatio < c.MinFaceRatio {
+		add(IssueFaceTooSmall, models.SeverityError,
+			fmt.Sprintf("The face covers %.1f%% of the photo", q.FaceRatio*100),
+			"Move closer to the camera so your face fills more of the frame.")
+	}
+
+	margin := int(float64(frame.Dx()) * edgeMarginFraction)
+	if face.Min.X <= margin || face.Min.Y <= margin || face.Max.X >= frame.Max.X-margin || face.Max.Y >= frame.Max.Y-margin {
+		add(IssueFaceCutOff, models.SeverityWarning,
+			"The face touches the edge of the photo",
+			"Centre your face in the frame with some space around it.")
+	}
+
+	if q.Sharpness < c.MinSharpness {
+		add(IssueBlurry, models.SeverityError,
+			fmt.Sprintf("The face is blurry (sharpness %.0f, minimum %.0f)", q.Sharpness, c.MinSharpness),
+			"Hold the camera steady, tap to focus on your face and clean the lens.")
+	}
+
+	switch {
+	case q.Brightness < c.MinBrightness || q.ShadowClip > c.MaxClipped:
+		add(IssueUnderexposed, models.SeverityWarning,
+			fmt.Sprintf("The face is too dark (brightness %.0f)", q.Brightness),
+			"Face a window or a soft light source and avoid strong light behind you.")
+	case q.Brightness > c.MaxBrightness || q.HighlightClip > c.MaxClipped:
+		add(IssueOverexposed, models.SeverityWarning,
+			fmt.Sprintf("The face is too bright (brightness %.0f)", q.Brightness),
+			"Avoid direct sunlight or flash; diffused light works best.")
+	case q.Contrast < c.MinContrast:
+		add(IssueLowContrast, models.SeverityWarning,
+			"The face looks flat or hazy",
+			"Use even but directional light and make sure the lens is clean.")
+	}
+
+	if q.Pose != nil {
+		var turned []string
+		if math.Abs(q.Pose.Yaw) > c.MaxYaw {
+			turned = append(turned, fmt.Sprintf("turned %.0f°", math.Abs(q.Pose.Yaw)))
+		}
+		if math.Abs(q.Pose.Pitch) > c.MaxPitch {
+			turned = append(turned, fmt.Sprintf("tilted up or down %.0f°", math.Abs(q.Pose.Pitch)))
+		}
+		if math.Abs(q.Pose.Roll) > c.MaxRoll {
+			turned = append(turned, fmt.Sprintf("tilted sideways %.0f°", math.Abs(q.Pose.Roll)))
+		}
+		if len(turned) > 0 {
+			add(IssueHeadTurned, models.SeverityWarning,
+				"The head is "+strings.Join(turned, ", "),
+				"Look straight into the camera with your head level.")
+		}
+	}
+
+	if q.SkinCoverage > 0 && q.SkinCoverage < c.MinSkinCoverage {
+		add(IssueFaceOccluded, models.SeverityWarning,
+			fmt.Sprintf("Only %.0f%% of the face is clearly visible", q.SkinCoverage*100),
+			"Move hair, hands, glasses or masks away from your face.")
+	}
+
+	return issues
+}
+
+// noFaceIssue is reported when detection finds nothing
+func noFaceIssue() models.QualityIssue {
+	return models.QualityIssue{
+		Code:     IssueNoFace,
+		Severity: models.SeverityError,
+		Message:  "No face was detected in the photo",
+		Tip:      "Use a well-lit, front-facing photo where your whole face is visible.",
+	}
+}
+
+// buildQualityReport collects the issues of the checked faces
+func buildQualityReport(faceCount int, checked []int, issues [][]models.QualityIssue) models.QualityReport {
+	report := models.QualityReport{
+		Acceptable: true,
+		FaceCount:  faceCount,
+		Checked:    checked,
+		Issues:     []models.QualityIssue{},
+	}
+	if faceCount == 0 {
+		report.Issues = append(report.Issues, noFaceIssue())
+	}
+	for _, faceIssues := range issues {
+		report.Issues = append(report.Issues, faceIssues...)
+	}
+	for _, issue := range report.Issues {
+		if issue.Severity == models.SeverityError {
+			report.Acceptable = false
+		}
+	}
+	return report
+}
+
+// qualityReport checks the selected faces of an already loaded image, given
+// their measurements in the order of selected
+func (ms *MakeupService) qualityReport(img gocv.Mat, faceCount int, selected []int, measured []faceMeasurement) models.QualityReport {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+
+	issues := make([][]models.QualityIssue, len(selected))
+	for i, index := range selected {
+		issues[i] = ms.analyzeFace(img, gray, index, measured[i]).Issues
+	}
+	return buildQualityReport(faceCount, selected, issues)
+}
+
+// CheckQuality runs the photo pre-check on the faces chosen by sel
+func (ms *MakeupService) CheckQuality(imagePath string, sel FaceSelection) (models.QualityReport, error) {
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return models.QualityReport{}, fmt.Errorf("failed to load image: %s", imagePath)
+	}
+	defer img.Close()
+
+	faces, err := ms.detectFaces(img)
+	if err != nil {
+		return models.QualityReport{}, err
+	}
+	if len(faces) == 0 {
+		return buildQualityReport(0, []int{}, nil), nil
+	}
+
+	selected, err := selectFaces(faces, sel)
+	if err != nil {
+		return models.QualityReport{}, err
+	}
+	return ms.qualityReport(img, len(faces), selected, ms.measureFaces(img, faces, selected)), nil
+}
+
+// UploadQuality returns the pre-check for a fresh upload, or nil when
+// upload checks are disabled or the check itself fails.
+func (ms *MakeupService) UploadQuality(imagePath string) *models.QualityReport {
+	if !ms.quality.CheckOnUpload {
+		return nil
+	}
+	report, err := ms.CheckQuality(imagePath, FaceSelection{Mode: FaceSelectLargest})
+	if err != nil {
+		log.Printf("Quality check failed for %s: %v", imagePath, err)
+		return nil
+	}
+	return &report
+}
+
+// qualityError summarises the blocking issues of a rejected photo
+func qualityError(report models.QualityReport) error {
+	var codes []string
+	for _, issue := range report.Issues {
+		if issue.Severity == models.SeverityError {
+			codes = append(codes, issue.Code)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrPoorQuality, strings.Join(codes, ", "))
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"makeup-api/internal/models"
+	"reflect"
+	"testing"
+)
+
+func issueCodes(issues []models.QualityIssue) []string {
+	codes := []string{}
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func TestQualityEvaluate(t *testing.T) {
+	config := QualityConfig{}.withDefaults()
+	frame := image.Rect(0, 0, 1000, 1000)
+	centred := image.Rect(300, 300, 700, 700)
+	good := models.FaceQuality{
+		FaceRatio:    0.16,
+		Sharpness:    200,
+		Brightness:   130,
+		Contrast:     45,
+		SkinCoverage: 0.8,
+		Pose:         &models.HeadPose{Yaw: 5, Pitch: 3, Roll: 2},
+	}
+
+	tests := []struct {
+		name   string
+		face   image.Rectangle
+		modify func(q *models.FaceQuality)
+		want   []string
+	}{
+		{"good photo", centred, func(q *models.FaceQuality) {}, []string{}},
+		{"small face", centred, func(q *models.FaceQuality) { q.FaceRatio = 0.01 }, []string{IssueFaceTooSmall}},
+		{"touches edge", image.Rect(0, 300, 400, 700), func(q *models.FaceQuality) {}, []string{IssueFaceCutOff}},
+		{"blurry", centred, func(q *models.FaceQuality) { q.Sharpness = 10 }, []string{IssueBlurry}},
+		{"dark", centred, func(q *models.FaceQuality) { q.Brightness = 30 }, []string{IssueUnderexposed}},
+		{"crushed shadows", centred, func(q *models.FaceQuality) { q.ShadowClip = 0.5 }, []string{IssueUnderexposed}},
+		{"bright", centred, func(q *models.FaceQuality) { q.Brightness = 240 }, []string{IssueOverexposed}},
+		{"flat", centred, func(q *models.FaceQuality) { q.Contrast = 5 }, []string{IssueLowContrast}},
+		{"turned", centred, func(q *models.FaceQuality) { q.Pose = &models.HeadPose{Yaw: 45} }, []string{IssueHeadTurned}},
+		{"no pose", centred, func(q *models.FaceQuality) { q.Pose = nil }, []string{}},
+		{"occluded", centred, func(q *models.FaceQuality) { q.SkinCoverage = 0.2 }, []string{IssueFaceOccluded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := good
+			tt.modify(&q)
+			issues := config.evaluate(3, tt.face, frame, q)
+			if got := issueCodes(issues); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issues = %v, want %v", got, tt.want)
+			}
+			for _, issue := range issues {
+				if issue.Face == nil || *issue.Face != 3 {
+					t.Errorf("issue %s is not attributed to face 3", issue.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildQualityReport(t *testing.T) {
+	warning := models.QualityIssue{Code: IssueFaceCutOff, Severity: models.SeverityWarning}
+	blocking := models.QualityIssue{Code: IssueBlurry, Severity: models.SeverityError}
+
+	tests := []struct {
+		name       string
+		faceCount  int
+		issues     [][]models.QualityIssue
+		acceptable bool
+		codes      []string
+	}{
+		{"no faces", 0, nil, false, []string{IssueNoFace}},
+		{"clean", 2, [][]models.QualityIssue{{}, {}}, true, []string{}},
+		{"warnings only", 1, [][]models.QualityIssue{{warning}}, true, []string{IssueFaceCutOff}},
+		{"blocking issue", 2, [][]models.QualityIssue{{warning}, {blocking}}, false, []string{IssueFaceCutOff, IssueBlurry}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := buildQualityReport(tt.faceCount, []int{}, tt.issues)
+			if report.Acceptable != tt.acceptable {
+				t.Errorf("Acceptable = %v, want %v", report.Acceptable, tt.acceptable)
+			}
+			if got := issueCodes(report.Issues); !reflect.DeepEqual(got, tt.codes) {
+				t.Errorf("issues = %v, want %v", got, tt.codes)
+			}
+		})
+	}
+}
+
+func TestCheckQuality(t *testing.T) {
+	photo := writeTestPhoto(t, 400, 300)
+
+	t.Run("small face at the edge", func(t *testing.T) {
+		ms := newTestMakeupService(t, &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(0, 0, 20, 20)}}, QualityConfig{})
+		report, err := ms.CheckQuality(photo, FaceSelection{Mode: FaceSelectLargest})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if report.Acceptable || report.FaceCount != 1 || !reflect.DeepEqual(report.Checked, []int{0}) {
+			t.Errorf("report = %+v, want face 0 checked and rejected", report)
+		}
+		codes := issueCodes(report.Issues)
+		for _, want := range []string{IssueFaceTooSmall, IssueFaceCutOff} {
+			if !contains(codes, want) {
+				t.Errorf("issues %v lack %s", codes, want)
+			}
+		}
+	})
+
+	t.Run("no faces", func(t *testing.T) {
+		ms := newTestMakeupService(t, &FakeFaceDetector{}, QualityConfig{})
+		report, err := ms.CheckQuality(photo, FaceSelection{Mode: FaceSelectLargest})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if report.Acceptable || !reflect.DeepEqual(issueCodes(report.Issues), []string{IssueNoFace}) {
+			t.Errorf("report = %+v, want a single no_face issue", report)
+		}
+	})
+
+	t.Run("detector error", func(t *testing.T) {
+		detectorErr := errors.New("model exploded")
+		ms := newTestMakeupService(t, &FakeFaceDetector{Err: detectorErr}, QualityConfig{})
+		if _, err := ms.CheckQuality(photo, FaceSelection{Mode: FaceSelectLargest}); err == nil {
+			t.Error("got no error")
+		}
+	})
+}
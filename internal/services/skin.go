@@ -0,0 +1,168 @@
+package services
+
+import (
+	"image"
+	"makeup-api/internal/models"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// The YCrCb box that contains skin of every tone under ordinary lighting
+var (
+	skinLower = gocv.NewScalar(0, 133, 77, 0)
+	skinUpper = gocv.NewScalar(255, 173, 127, 0)
+)
+
+// skinModel is the chroma of one person's skin, as a mean and spread of Cr
+// and Cb
+type skinModel struct {
+	cr, cb             float64
+	crSpread, cbSpread float64
+}
+
+// genericSkin is used when too little skin is visible to sample
+var genericSkin = skinModel{cr: 153, cb: 102, crSpread: 10, cbSpread: 12}
+
+// likelihood weights a pixel by its chroma distance from the model, in
+// spreads. Pixels outside the generic skin box are never skin.
+func (m skinModel) likelihood(cr, cb uint8) float64 {
+	if float64(cr) < skinLower.Val2 || float64(cr) > skinUpper.Val2 ||
+		float64(cb) < skinLower.Val3 || float64(cb) > skinUpper.Val3 {
+		return 0
+	}
+	dcr := (float64(cr) - m.cr) / m.crSpread
+	dcb := (float64(cb) - m.cb) / m.cbSpread
+	return math.Exp(-(dcr*dcr + dcb*dcb) / 8)
+}
+
+// sampleSkin fits a skin model to the pixels under the sample mask that fall
+// in the generic skin box.
+func sampleSkin(ycrcb []uint8, sample []uint8) skinModel {
+	var n, sumCr, sumCb, sqCr, sqCb float64
+	for i, weight := range sample {
+		if weight < 128 || genericSkin.likelihood(ycrcb[i*3+1], ycrcb[i*3+2]) == 0 {
+			continue
+		}
+		cr, cb := float64(ycrcb[i*3+1]), float64(ycrcb[i*3+2])
+		sumCr += cr
+		sumCb += cb
+		sqCr += cr * cr
+		sqCb += cb * cb
+		n++
+	}
+	if n < 50 {
+		return genericSkin
+	}
+	m := skinModel{cr: sumCr / n, cb: sumCb / n}
+	m.crSpread = math.Max(math.Sqrt(math.Max(sqCr/n-m.cr*m.cr, 0)), 3)
+	m.cbSpread = math.Max(math.Sqrt(math.Max(sqCb/n-m.cb*m.cb, 0)), 3)
+	return m
+}
+
+// skinPatches are small squares on the cheeks and nose bridge, which are
+// skin on almost every face whatever the hair, glasses or beard.
+func skinPatches(lm FaceLandmarks) [][]image.Point {
+	half := int(faceWidth(lm) * 0.05)
+	centers := append(cheekApples(lm), lm.Points[28])
+	patches := make([][]image.Point, len(centers))
+	for i, c := range centers {
+		patches[i] = []image.Point{
+			{c.X - half, c.Y - half}, {c.X + half, c.Y - half},
+			{c.X + half, c.Y + half}, {c.X - half, c.Y + half},
+		}
+	}
+	return patches
+}
+
+// skinRegion segments the skin of a face. The face outline minus the
+// features bounds the search, and each pixel inside is weighted by how
+// close its colour is to skin sampled from the cheeks, which drops hair,
+// beard, glasses and background that fall inside the outline.
+func skinRegion(img gocv.Mat, lm FaceLandmarks) (*regionMask, bool) {
+	outline := lm.FaceOutline()
+	rect := polygonBounds(outline).Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil, false
+	}
+
+	mask := polygonMask(rect, [][]image.Point{outline}, featureHoles(lm))
+	sample := polygonMask(rect, skinPatches(lm), nil)
+	defer sample.Close()
+
+	region := &regionMask{rect: rect, mask: mask}
+	ycrcb := region.source(img)
+	defer ycrcb.Close()
+	gocv.CvtColor(ycrcb, &ycrcb, gocv.ColorBGRToYCrCb)
+
+	pixels, errPixels := ycrcb.DataPtrUint8()
+	weights, errMask := mask.DataPtrUint8()
+	samples, errSample := sample.DataPtrUint8()
+	if errPixels == nil && errMask == nil && errSample == nil {
+		model := sampleSkin(pixels, samples)
+		for i, weight := range weights {
+			if weight == 0 {
+				continue
+			}
+			weights[i] = clampUint8(float64(weight) * model.likelihood(pixels[i*3+1], pixels[i*3+2]))
+		}
+	}
+
+	// Drop isolated speckles before softening the edges
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Pt(5, 5))
+	defer kernel.Close()
+	gocv.MorphologyEx(region.mask, &region.mask, gocv.MorphOpen, kernel)
+	featherMask(&region.mask, featherRadius(lm, 0.015))
+
+	return region, true
+}
+
+// renderSkin smooths the skin with a bilateral filter, which flattens
+// blemishes and uneven tone without blurring across edges, then adds back
+// a share of the fine texture so the skin doesn't look plastic. Stronger
+// smoothing keeps less texture.
+func (ms *MakeupService) renderSkin(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	strength := clamp01(layer.Opacity)
+	if strength <= 0 {
+		return
+	}
+
+	region, ok := skinRegion(*img, lm)
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	source := region.source(*img)
+	defer source.Close()
+
+	// Filter diameter follows face size so small faces aren't over-smoothed
+	diameter := int(faceWidth(lm) * 0.03)
+	if diameter < 5 {
+		diameter = 5
+	}
+	if diameter > 15 {
+		diameter = 15
+	}
+	smoothed := gocv.NewMat()
+	defer smoothed.Close()
+	gocv.BilateralFilter(source, &smoothed, diameter, 20+60*strength, float64(diameter))
+
+	// Fine texture is what a small blur removes
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.GaussianBlur(source, &blurred, image.Pt(3, 3), 0, 0, gocv.BorderDefault)
+
+	out, errOut := smoothed.DataPtrUint8()
+	src, errSrc := source.DataPtrUint8()
+	low, errLow := blurred.DataPtrUint8()
+	if errOut != nil || errSrc != nil || errLow != nil {
+		return
+	}
+	texture := 1 - strength
+	for i := range out {
+		out[i] = clampUint8(float64(out[i]) + texture*(float64(src[i])-float64(low[i])))
+	}
+
+	region.blend(img, smoothed, clamp01(strength*2.5))
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"makeup-api/internal/models"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// monkScale is the ten swatch Monk Skin Tone scale, lightest first
+var monkScale = []string{
+	"#F6EDE4", "#F3E7DB", "#F7EAD0", "#EADABA", "#D7BD96",
+	"#A07E56", "#825C43", "#604134", "#3A312A", "#292420",
+}
+
+// Undertone hue boundaries, in degrees of CIELAB hue. Skin sits between
+// pink (lower angles) and yellow (higher angles).
+const (
+	coolHueBelow = 50
+	warmHueAbove = 60
+)
+
+// measureSkinTone averages the colour of the segmented skin of a face
+func measureSkinTone(img gocv.Mat, lm FaceLandmarks) (labColor, bool) {
+	region, ok := skinRegion(img, lm)
+	if !ok {
+		return labColor{}, false
+	}
+	defer region.Close()
+
+	lab := region.source(img)
+	defer lab.Close()
+	gocv.CvtColor(lab, &lab, gocv.ColorBGRToLab)
+
+	pixels, err := lab.DataPtrUint8()
+	if err != nil {
+		return labColor{}, false
+	}
+	weights, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return labColor{}, false
+	}
+	return meanLab(pixels, weights)
+}
+
+// describeSkinTone places a skin colour on the Monk scale by the nearest
+// swatch, weighting lightness over chroma since lighting shifts chroma
+// more, and classifies the undertone by hue angle.
+func describeSkinTone(skin labColor) models.SkinTone {
+	a, b := skin.A-128, skin.B-128
+	hue := degrees(math.Atan2(b, a))
+
+	best, bestDistance := 0, math.Inf(1)
+	for i, hex := range monkScale {
+		swatch, err := parseHexColor(hex)
+		if err != nil {
+			continue
+		}
+		ref := toLab(swatch)
+		dL, dA, dB := skin.L-ref.L, skin.A-ref.A, skin.B-ref.B
+		if d := dL*dL + 0.25*(dA*dA+dB*dB); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+
+	undertone := models.UndertoneNeutral
+	switch {
+	case hue < coolHueBelow:
+		undertone = models.UndertoneCool
+	case hue > warmHueAbove:
+		undertone = models.UndertoneWarm
+	}
+
+	return models.SkinTone{
+		Color:     toHex(fromLab(skin)),
+		MonkScale: best + 1,
+		Undertone: undertone,
+		Lightness: math.Round(skin.L/2.55*10) / 10,
+		Hue:       math.Round(hue*10) / 10,
+	}
+}
+
+// fallbackSkin is a medium complexion (Monk 5), used for relative shades
+// when a face's skin can't be measured
+func fallbackSkin() labColor {
+	swatch, _ := parseHexColor(monkScale[4])
+	return toLab(swatch)
+}
+
+// shadeHex resolves a relative shade against a skin colour
+func shadeHex(skin labColor, shade models.Shade) string {
+	return toHex(fromLab(labColor{
+		L: skin.L + shade.Depth*2.55,
+		A: skin.A + shade.Red,
+		B: skin.B + shade.Yellow,
+	}))
+}
+
+// resolveShades returns a copy of the style with every relative shade
+// replaced by a concrete colour for this skin. A foundation with neither
+// colour nor shade is matched to the skin.
+func resolveShades(style models.MakeupStyle, skin labColor) models.MakeupStyle {
+	layers := make([]models.EffectLayer, len(style.Layers))
+	for i, layer := range style.Layers {
+		switch {
+		case layer.Shade != nil:
+			layer.Color = shadeHex(skin, *layer.Shade)
+		case layer.Type == models.LayerFoundation && layer.Color == "":
+			layer.Color = shadeHex(skin, models.Shade{})
+		}
+		layers[i] = layer
+	}
+	style.Layers = layers
+	return style
+}
+
+// renderFoundation evens out the skin towards the foundation shade. Each
+// pixel's colour variation shrinks with coverage, fading redness and
+// blotches, while most lightness variation is kept so the face keeps its
+// shape.
+func (ms *MakeupService) renderFoundation(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	coverage := clamp01(layer.Opacity)
+	if err != nil || coverage <= 0 {
+		return
+	}
+
+	region, ok := skinRegion(*img, lm)
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	gocv.CvtColor(overlay, &overlay, gocv.ColorBGRToLab)
+
+	lab, err := overlay.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	weights, err := region.mask.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	current, ok := meanLab(lab, weights)
+	if !ok {
+		return
+	}
+
+	target := toLab(shade)
+	base := labColor{
+		L: current.L + (target.L-current.L)*coverage,
+		A: current.A + (target.A-current.A)*coverage,
+		B: current.B + (target.B-current.B)*coverage,
+	}
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		lab[i*3] = clampUint8(base.L + (float64(lab[i*3])-current.L)*(1-coverage*0.5))
+		lab[i*3+1] = clampUint8(base.A + (float64(lab[i*3+1])-current.A)*(1-coverage))
+		lab[i*3+2] = clampUint8(base.B + (float64(lab[i*3+2])-current.B)*(1-coverage))
+	}
+
+	gocv.CvtColor(overlay, &overlay, gocv.ColorLabToBGR)
+	region.blend(img, overlay, 1)
+}
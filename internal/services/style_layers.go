@@ -0,0 +1,364 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"makeup-api/internal/models"
+	"math"
+	"regexp"
+
+	"gocv.io/x/gocv"
+)
+
+// ErrInvalidStyle is returned when a style definition fails validation
+var ErrInvalidStyle = errors.New("invalid style")
+
+// paramKind is the expected type of a layer parameter
+type paramKind int
+
+const (
+	kindNumber paramKind = iota
+	kindBool
+	kindColor
+	kindEnum
+)
+
+type paramSpec struct {
+	kind   paramKind
+	values []string // allowed values of an enum
+}
+
+// colorUse says whether a layer type takes a colour
+type colorUse int
+
+const (
+	colorNone colorUse = iota
+	colorOptional
+	colorRequired
+)
+
+// layerSpec describes what a layer type accepts
+type layerSpec struct {
+	color   colorUse
+	regions []string // allowed regions; empty means the layer takes none
+	region  bool     // a region is required
+	blend   string   // default blend mode; empty when the layer blends itself
+	params  map[string]paramSpec
+}
+
+var layerSpecs = map[string]layerSpec{
+	models.LayerSkin: {
+		color: colorNone,
+	},
+	models.LayerFoundation: {
+		color: colorOptional,
+	},
+	models.LayerLipstick: {
+		color: colorRequired,
+		params: map[string]paramSpec{
+			"finish": {kind: kindEnum, values: []string{models.FinishMatte, models.FinishSatin, models.FinishGloss, models.FinishMetallic}},
+		},
+	},
+	models.LayerEyeshadow: {
+		color:  colorRequired,
+		blend:  models.BlendMultiply,
+		params: map[string]paramSpec{"crease_color": {kind: kindColor}},
+	},
+	models.LayerEyeliner: {
+		color: colorRequired,
+		params: map[string]paramSpec{
+			"thickness": {kind: kindNumber},
+			"wing":      {kind: kindBool},
+		},
+	},
+	models.LayerMascara: {
+		color: colorRequired,
+	},
+	models.LayerContour: {
+		color: colorOptional,
+		blend: models.BlendMultiply,
+	},
+	models.LayerBlush: {
+		color:  colorRequired,
+		blend:  models.BlendNormal,
+		params: map[string]paramSpec{"radius": {kind: kindNumber}},
+	},
+	models.LayerHighlighter: {
+		color:   colorRequired,
+		regions: []string{models.HighlightCheekbones, models.HighlightNoseBridge, models.HighlightCupidsBow},
+		blend:   models.BlendScreen,
+		params:  map[string]paramSpec{"radius": {kind: kindNumber}},
+	},
+	models.LayerTint: {
+		color: colorRequired,
+		regions: []string{
+			models.RegionFace, models.RegionLips, models.RegionCheeks,
+			models.RegionEyelids, models.RegionJaw, models.RegionForehead,
+		},
+		region: true,
+		blend:  models.BlendNormal,
+	},
+}
+
+var blendModes = []string{models.BlendNormal, models.BlendMultiply, models.BlendScreen, models.BlendOverlay, models.BlendSoftLight}
+
+// intensityReference is the style intensity at which layers are drawn at
+// their own opacity
+const intensityReference = 5
+
+// scaleIntensity returns a copy of the style with every layer's opacity
+// scaled by the style intensity: 5 keeps the opacities as written, 10
+// doubles them and 1 draws at a fifth, never beyond full strength.
+func scaleIntensity(style models.MakeupStyle) models.MakeupStyle {
+	factor := float64(style.Intensity) / intensityReference
+	layers := make([]models.EffectLayer, len(style.Layers))
+	for i, layer := range style.Layers {
+		layer.Opacity = math.Min(1, layer.Opacity*factor)
+		layers[i] = layer
+	}
+	style.Layers = layers
+	return style
+}
+
+// styleIDPattern keeps style IDs safe to use in URLs and file names
+var styleIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateStyle checks a style definition and every one of its layers
+func ValidateStyle(style models.MakeupStyle) error {
+	if !styleIDPattern.MatchString(style.ID) {
+		return fmt.Errorf("%w: id %q must be lower-case letters, digits, '-' or '_'", ErrInvalidStyle, style.ID)
+	}
+	if style.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidStyle)
+	}
+	if style.Intensity < 1 || style.Intensity > 10 {
+		return fmt.Errorf("%w: intensity must be between 1 and 10", ErrInvalidStyle)
+	}
+	if len(style.Layers) == 0 {
+		return fmt.Errorf("%w: at least one layer is required", ErrInvalidStyle)
+	}
+	for i, layer := range style.Layers {
+		if err := validateLayer(layer); err != nil {
+			return fmt.Errorf("%w: layer %d (%s): %v", ErrInvalidStyle, i, layer.Type, err)
+		}
+	}
+	return nil
+}
+
+func validateLayer(layer models.EffectLayer) error {
+	spec, ok := layerSpecs[layer.Type]
+	if !ok {
+		return fmt.Errorf("unknown type")
+	}
+
+	if layer.Opacity <= 0 || layer.Opacity > 1 {
+		return fmt.Errorf("opacity must be in (0, 1]")
+	}
+
+	hasColor := layer.Color != "" || layer.Shade != nil
+	switch {
+	case spec.color == colorNone && hasColor:
+		return fmt.Errorf("takes no color or shade")
+	case spec.color == colorRequired && !hasColor:
+		return fmt.Errorf("color or shade is required")
+	}
+	if layer.Color != "" {
+		if _, err := parseHexColor(layer.Color); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case layer.Region == "" && spec.region:
+		return fmt.Errorf("region is required (one of %v)", spec.regions)
+	case layer.Region != "" && !contains(spec.regions, layer.Region):
+		if len(spec.regions) == 0 {
+			return fmt.Errorf("takes no region")
+		}
+		return fmt.Errorf("unknown region %q (want one of %v)", layer.Region, spec.regions)
+	}
+
+	if layer.BlendMode != "" {
+		if spec.blend == "" {
+			return fmt.Errorf("takes no blend_mode")
+		}
+		if !contains(blendModes, layer.BlendMode) {
+			return fmt.Errorf("unknown blend_mode %q (want one of %v)", layer.BlendMode, blendModes)
+		}
+	}
+
+	for name, value := range layer.Params {
+		param, ok := spec.params[name]
+		if !ok {
+			return fmt.Errorf("unknown param %q", name)
+		}
+		if err := validateParam(param, value); err != nil {
+			return fmt.Errorf("param %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func validateParam(spec paramSpec, value interface{}) error {
+	switch spec.kind {
+	case kindNumber:
+		if v, ok := toFloat(value); !ok || v <= 0 {
+			return fmt.Errorf("must be a positive number")
+		}
+	case kindBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be true or false")
+		}
+	case kindColor:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a colour")
+		}
+		if _, err := parseHexColor(s); err != nil {
+			return err
+		}
+	case kindEnum:
+		if s, ok := value.(string); !ok || !contains(spec.values, s) {
+			return fmt.Errorf("must be one of %v", spec.values)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat accepts the numeric types JSON and YAML decoding produce
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func paramFloat(layer models.EffectLayer, name string, def float64) float64 {
+	if v, ok := toFloat(layer.Params[name]); ok && v > 0 {
+		return v
+	}
+	return def
+}
+
+func paramBool(layer models.EffectLayer, name string, def bool) bool {
+	if v, ok := layer.Params[name].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func paramString(layer models.EffectLayer, name string, def string) string {
+	if v, ok := layer.Params[name].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// blendMode is the layer's blend mode or the default for its type
+func blendMode(layer models.EffectLayer) string {
+	if layer.BlendMode != "" {
+		return layer.BlendMode
+	}
+	return layerSpecs[layer.Type].blend
+}
+
+// renderLayer applies one effect layer to a face
+func (ms *MakeupService) renderLayer(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	switch layer.Type {
+	case models.LayerSkin:
+		ms.renderSkin(img, lm, layer)
+	case models.LayerFoundation:
+		ms.renderFoundation(img, lm, layer)
+	case models.LayerLipstick:
+		ms.renderLipstick(img, lm, layer)
+	case models.LayerEyeshadow:
+		for _, eye := range eyeShapes(lm) {
+			renderEyeshadow(img, lm, eye, layer)
+		}
+	case models.LayerEyeliner:
+		for _, eye := range eyeShapes(lm) {
+			renderEyeliner(img, eye, layer)
+		}
+	case models.LayerMascara:
+		for _, eye := range eyeShapes(lm) {
+			renderMascara(img, lm, eye, layer)
+		}
+	case models.LayerContour:
+		ms.renderContour(img, lm, layer)
+	case models.LayerBlush:
+		ms.renderBlush(img, lm, layer)
+	case models.LayerHighlighter:
+		ms.renderHighlighter(img, lm, layer)
+	case models.LayerTint:
+		ms.renderTint(img, lm, layer)
+	}
+}
+
+// renderTint colours a named region of the face with the layer's blend mode
+func (ms *MakeupService) renderTint(img *gocv.Mat, lm FaceLandmarks, layer models.EffectLayer) {
+	shade, err := parseHexColor(layer.Color)
+	if err != nil || layer.Opacity <= 0 {
+		return
+	}
+
+	region, ok := tintRegion(*img, lm, layer.Region)
+	if !ok {
+		return
+	}
+	defer region.Close()
+
+	overlay := region.source(*img)
+	defer overlay.Close()
+	blendColor(overlay, shade, blendMode(layer))
+	region.blend(img, overlay, clamp01(layer.Opacity))
+}
+
+// tintRegion builds the mask for a tint region
+func tintRegion(img gocv.Mat, lm FaceLandmarks, name string) (*regionMask, bool) {
+	switch name {
+	case models.RegionFace:
+		return skinRegion(img, lm)
+	case models.RegionLips:
+		return lipRegion(img, lm)
+	case models.RegionCheeks:
+		r := faceWidth(lm) * 0.12
+		var spots []softSpot
+		for _, apple := range cheekApples(lm) {
+			spots = append(spots, softSpot{center: apple, rx: r, ry: r})
+		}
+		return spotRegion(img, lm, spots, lm.FaceOutline(), featureHoles(lm))
+	case models.RegionEyelids:
+		areas := [][]image.Point{
+			lm.EyeArea(lm.RightEye(), lm.RightBrow()),
+			lm.EyeArea(lm.LeftEye(), lm.LeftBrow()),
+		}
+		var openings [][]image.Point
+		for _, eye := range eyeShapes(lm) {
+			openings = append(openings, eye.opening())
+		}
+		return newRegionMask(img, areas, openings, featherRadius(lm, 0.02))
+	case models.RegionJaw:
+		return newRegionMask(img, [][]image.Point{lm.JawBand(0.15)}, nil, featherRadius(lm, 0.04))
+	case models.RegionForehead:
+		// Between the brows and the estimated hairline of the face outline
+		outline := lm.FaceOutline()
+		forehead := append(lm.pick(17, 18, 19, 20, 21, 22, 23, 24, 25, 26), outline[17:]...)
+		return newRegionMask(img, [][]image.Point{forehead}, featureHoles(lm), featherRadius(lm, 0.04))
+	}
+	return nil, false
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"makeup-api/internal/models"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateStyle(t *testing.T) {
+	valid := func() models.MakeupStyle {
+		return models.MakeupStyle{
+			ID:        "evening_glam-2",
+			Name:      "Evening Glam",
+			Intensity: 7,
+			Layers: []models.EffectLayer{
+				{Type: models.LayerSkin, Opacity: 0.5},
+				{Type: models.LayerFoundation, Opacity: 0.4},
+				{Type: models.LayerLipstick, Color: "#A0303C", Opacity: 0.8, Params: map[string]interface{}{"finish": models.FinishGloss}},
+				{Type: models.LayerEyeshadow, Shade: &models.Shade{Depth: -20}, Opacity: 0.6, BlendMode: models.BlendSoftLight, Params: map[string]interface{}{"crease_color": "#3C2820"}},
+				{Type: models.LayerEyeliner, Color: "#101010", Opacity: 1, Params: map[string]interface{}{"thickness": 2, "wing": true}},
+				{Type: models.LayerHighlighter, Color: "#FFF0DC", Region: models.HighlightNoseBridge, Opacity: 0.3},
+				{Type: models.LayerTint, Color: "#C06070", Region: models.RegionCheeks, Opacity: 0.2},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *models.MakeupStyle)
+		want   string // part of the error message; empty means valid
+	}{
+		{"valid", func(s *models.MakeupStyle) {}, ""},
+		{"upper-case id", func(s *models.MakeupStyle) { s.ID = "Glam" }, "id"},
+		{"id with a path", func(s *models.MakeupStyle) { s.ID = "../glam" }, "id"},
+		{"id with a dot", func(s *models.MakeupStyle) { s.ID = "glam.v2" }, "id"},
+		{"id too long", func(s *models.MakeupStyle) { s.ID = strings.Repeat("a", 65) }, "id"},
+		{"no name", func(s *models.MakeupStyle) { s.Name = "" }, "name is required"},
+		{"intensity too low", func(s *models.MakeupStyle) { s.Intensity = 0 }, "intensity"},
+		{"intensity too high", func(s *models.MakeupStyle) { s.Intensity = 11 }, "intensity"},
+		{"no layers", func(s *models.MakeupStyle) { s.Layers = nil }, "at least one layer"},
+		{"unknown type", func(s *models.MakeupStyle) { s.Layers[0].Type = "glitter" }, "layer 0 (glitter): unknown type"},
+		{"zero opacity", func(s *models.MakeupStyle) { s.Layers[1].Opacity = 0 }, "opacity"},
+		{"opacity above one", func(s *models.MakeupStyle) { s.Layers[1].Opacity = 1.5 }, "opacity"},
+		{"colour on skin", func(s *models.MakeupStyle) { s.Layers[0].Color = "#FFFFFF" }, "takes no color"},
+		{"missing colour", func(s *models.MakeupStyle) { s.Layers[2].Color = "" }, "color or shade is required"},
+		{"bad hex", func(s *models.MakeupStyle) { s.Layers[2].Color = "#GG0000" }, "layer 2"},
+		{"tint without region", func(s *models.MakeupStyle) { s.Layers[6].Region = "" }, "region is required"},
+		{"unknown region", func(s *models.MakeupStyle) { s.Layers[6].Region = "elbows" }, "unknown region"},
+		{"region on lipstick", func(s *models.MakeupStyle) { s.Layers[2].Region = models.RegionLips }, "takes no region"},
+		{"blend on lipstick", func(s *models.MakeupStyle) { s.Layers[2].BlendMode = models.BlendMultiply }, "takes no blend_mode"},
+		{"unknown blend", func(s *models.MakeupStyle) { s.Layers[3].BlendMode = "dissolve" }, "unknown blend_mode"},
+		{"unknown param", func(s *models.MakeupStyle) { s.Layers[4].Params["curl"] = true }, `unknown param "curl"`},
+		{"number param as text", func(s *models.MakeupStyle) { s.Layers[4].Params["thickness"] = "thick" }, `param "thickness"`},
+		{"negative number param", func(s *models.MakeupStyle) { s.Layers[4].Params["thickness"] = -1 }, `param "thickness"`},
+		{"bool param as text", func(s *models.MakeupStyle) { s.Layers[4].Params["wing"] = "yes" }, `param "wing"`},
+		{"colour param as number", func(s *models.MakeupStyle) { s.Layers[3].Params["crease_color"] = 42 }, `param "crease_color"`},
+		{"unknown enum value", func(s *models.MakeupStyle) { s.Layers[2].Params["finish"] = "sparkly" }, `param "finish"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := valid()
+			tt.modify(&style)
+			err := ValidateStyle(style)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidStyle) {
+				t.Fatalf("error = %v, want ErrInvalidStyle", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStyle(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		yaml    bool
+		wantErr bool
+	}{
+		{"json", `{"id":"natural","name":"Natural","intensity":3,"layers":[{"type":"skin","opacity":0.5}]}`, false, false},
+		{"yaml", "id: natural\nname: Natural\nintensity: 3\nlayers:\n  - type: skin\n    opacity: 0.5\n", true, false},
+		{"unknown field", `{"id":"natural","name":"Natural","colour":"#FFFFFF"}`, false, true},
+		{"unknown layer field", "id: natural\nlayers:\n  - type: skin\n    opactiy: 0.5\n", true, true},
+		{"malformed json", `{"id":`, false, true},
+		{"malformed yaml", "id: [natural", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style, err := DecodeStyle([]byte(tt.data), tt.yaml)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidStyle) {
+					t.Errorf("error = %v, want ErrInvalidStyle", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if style.ID != "natural" || len(style.Layers) != 1 || style.Layers[0].Opacity != 0.5 {
+				t.Errorf("decoded %+v", style)
+			}
+		})
+	}
+}
+
+func TestScaleIntensity(t *testing.T) {
+	style := models.MakeupStyle{
+		Layers: []models.EffectLayer{
+			{Type: models.LayerSkin, Opacity: 0.2},
+			{Type: models.LayerLipstick, Color: "#A0303C", Opacity: 0.8},
+		},
+	}
+
+	tests := []struct {
+		intensity int
+		want      []float64
+	}{
+		{1, []float64{0.04, 0.16}},
+		{5, []float64{0.2, 0.8}},
+		{8, []float64{0.32, 1}},
+		{10, []float64{0.4, 1}},
+	}
+	for _, tt := range tests {
+		style.Intensity = tt.intensity
+		scaled := scaleIntensity(style)
+		for i, layer := range scaled.Layers {
+			if math.Abs(layer.Opacity-tt.want[i]) > 1e-9 {
+				t.Errorf("intensity %d layer %d: opacity = %v, want %v", tt.intensity, i, layer.Opacity, tt.want[i])
+			}
+		}
+	}
+	if style.Layers[1].Opacity != 0.8 {
+		t.Errorf("scaling changed the original style's layers")
+	}
+}
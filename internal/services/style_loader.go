@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"makeup-api/internal/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadStyles reads every .json, .yaml and .yml file in dir as one style
+// definition and validates it. Files are read in name order and a
+// duplicate ID is an error.
+func LoadStyles(dir string) ([]models.MakeupStyle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read styles directory: %v", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var styles []models.MakeupStyle
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		style, err := DecodeStyle(data, ext != ".json")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := ValidateStyle(style); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if other, ok := seen[style.ID]; ok {
+			return nil, fmt.Errorf("%s: style %q is already defined in %s", path, style.ID, other)
+		}
+		seen[style.ID] = path
+		styles = append(styles, style)
+	}
+
+	if len(styles) == 0 {
+		return nil, fmt.Errorf("no style definitions found in %s", dir)
+	}
+	return styles, nil
+}
+
+// DecodeStyle parses a JSON or YAML style definition. YAML is converted to
+// JSON first so both formats share the JSON field names, and unknown
+// fields are rejected so typos don't silently drop settings.
+func DecodeStyle(data []byte, isYAML bool) (models.MakeupStyle, error) {
+	var style models.MakeupStyle
+	if isYAML {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return style, fmt.Errorf("%w: %v", ErrInvalidStyle, err)
+		}
+		converted, err := json.Marshal(doc)
+		if err != nil {
+			return style, fmt.Errorf("%w: %v", ErrInvalidStyle, err)
+		}
+		data = converted
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&style); err != nil {
+		return style, fmt.Errorf("%w: %v", ErrInvalidStyle, err)
+	}
+	return style, nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"makeup-api/internal/models"
+)
+
+// CreateStyle validates and stores a new style at version 1
+func (ms *MakeupService) CreateStyle(style models.MakeupStyle) (models.MakeupStyle, error) {
+	if err := ValidateStyle(style); err != nil {
+		return style, err
+	}
+	style = withoutPreviews(style)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	created, err := ms.store.Create(style)
+	if err != nil {
+		return style, err
+	}
+	ms.styles[created.ID] = created
+	ms.queuePreview(created.ID)
+	return created, nil
+}
+
+// UpdateStyle replaces a style. style.Version must be the version the
+// change was based on; a stale one fails with repository.ErrVersionConflict.
+func (ms *MakeupService) UpdateStyle(style models.MakeupStyle) (models.MakeupStyle, error) {
+	if err := ValidateStyle(style); err != nil {
+		return style, err
+	}
+	style = withoutPreviews(style)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	updated, err := ms.store.Update(style)
+	if err != nil {
+		return style, err
+	}
+	ms.styles[updated.ID] = updated
+	ms.queuePreview(updated.ID)
+	return updated, nil
+}
+
+// DeleteStyle removes a style if version is still current
+func (ms *MakeupService) DeleteStyle(id string, version int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.store.Delete(id, version); err != nil {
+		return err
+	}
+	delete(ms.styles, id)
+	ms.queuePreview(id)
+	return nil
+}
+
+// withoutPreviews drops preview URLs a client may have echoed back from a
+// listing; they are generated, not stored
+func withoutPreviews(style models.MakeupStyle) models.MakeupStyle {
+	style.PreviewURL = ""
+	style.PreviewURLs = nil
+	return style
+}
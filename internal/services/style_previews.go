@@ -0,0 +1,328 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"makeup-api/internal/models"
+	"makeup-api/internal/repository"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// previewDir holds rendered previews, served under /uploads/previews, in
+// one subdirectory per style
+var previewDir = filepath.Join("uploads", "previews")
+
+// PreviewConfig controls style preview rendering
+type PreviewConfig struct {
+	FacesDir string // reference face photos, one preview is rendered per photo
+	Width    int    // preview width in pixels, default 400
+}
+
+// previewSet is the previews rendered for a style's current definition
+type previewSet struct {
+	urls []string
+}
+
+// referenceFace is a photo previews are rendered onto
+type referenceFace struct {
+	path string
+	name string // file name made safe for preview names
+	hash string // of the file contents
+}
+
+// previewRenderer renders previews in the background, one style at a time
+type previewRenderer struct {
+	faces []referenceFace
+	width int
+
+	mu      sync.Mutex
+	ready   map[string]previewSet // by style ID
+	pending map[string]bool
+	wake    chan struct{}
+}
+
+// PreviewStatus reports whether style previews are being rendered
+type PreviewStatus struct {
+	Enabled bool   `json:"enabled"`
+	Faces   int    `json:"faces,omitempty"`  // reference photos each style is rendered onto
+	Reason  string `json:"reason,omitempty"` // why previews are disabled
+}
+
+// StartPreviews renders a preview of every style onto each reference face
+// in the background, and re-renders a style whenever it changes. File
+// names carry a hash of the style definition and of the photo, so previews
+// are reused across restarts for as long as both are unchanged, and a
+// changed or re-created style never picks up a stale preview. When it
+// fails previews stay disabled and PreviewStatus reports why.
+func (ms *MakeupService) StartPreviews(config PreviewConfig) error {
+	faces, err := referenceFaces(config.FacesDir)
+	if err != nil {
+		ms.previewErr = err
+		return err
+	}
+	if err := os.MkdirAll(previewDir, 0755); err != nil {
+		ms.previewErr = fmt.Errorf("failed to create preview directory: %v", err)
+		return ms.previewErr
+	}
+
+	width := config.Width
+	if width <= 0 {
+		width = 400
+	}
+	ms.previews = &previewRenderer{
+		faces:   faces,
+		width:   width,
+		ready:   make(map[string]previewSet),
+		pending: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+	go ms.previewWorker()
+
+	for _, style := range ms.GetAvailableStyles() {
+		ms.queuePreview(style.ID)
+	}
+	return nil
+}
+
+// PreviewStatus reports whether previews are enabled, and if not why
+func (ms *MakeupService) PreviewStatus() PreviewStatus {
+	if p := ms.previews; p != nil {
+		return PreviewStatus{Enabled: true, Faces: len(p.faces)}
+	}
+	reason := "previews have not been started"
+	if ms.previewErr != nil {
+		reason = ms.previewErr.Error()
+	}
+	return PreviewStatus{Reason: reason}
+}
+
+// referenceFaces lists the image files in dir in name order
+func referenceFaces(dir string) ([]referenceFace, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference faces: %v", err)
+	}
+
+	var faces []referenceFace
+	for _, entry := range entries {
+		format := NormalizeFormat(strings.TrimPrefix(filepath.Ext(entry.Name()), "."))
+		if entry.IsDir() || (format != FormatJPEG && format != FormatPNG && format != FormatWebP) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference face: %v", err)
+		}
+		sum := sha256.Sum256(data)
+		faces = append(faces, referenceFace{
+			path: path,
+			name: faceName(path),
+			hash: hex.EncodeToString(sum[:]),
+		})
+	}
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("no reference face images in %s", dir)
+	}
+	sort.Slice(faces, func(i, j int) bool { return faces[i].path < faces[j].path })
+	return faces, nil
+}
+
+// queuePreview schedules a style's previews to be brought up to date. It
+// does nothing when previews are not enabled.
+func (ms *MakeupService) queuePreview(styleID string) {
+	p := ms.previews
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.pending[styleID] = true
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ms *MakeupService) previewWorker() {
+	p := ms.previews
+	for range p.wake {
+		for {
+			p.mu.Lock()
+			var styleID string
+			for id := range p.pending {
+				styleID = id
+				break
+			}
+			delete(p.pending, styleID)
+			p.mu.Unlock()
+
+			if styleID == "" {
+				break
+			}
+			ms.refreshPreviews(styleID)
+		}
+	}
+}
+
+// refreshPreviews renders the missing previews of a style's current
+// definition, then drops any other previews of the style. Previews of a
+// deleted style are removed.
+func (ms *MakeupService) refreshPreviews(styleID string) {
+	p := ms.previews
+
+	style, exists := ms.GetStyle(styleID)
+	if !exists {
+		removeStalePreviews(styleID, nil)
+		p.mu.Lock()
+		delete(p.ready, styleID)
+		p.mu.Unlock()
+		return
+	}
+
+	styleHash, err := repository.DefinitionHash(style)
+	if err != nil {
+		log.Printf("Previews of style %s failed: %v", style.ID, err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Join(previewDir, style.ID), 0755); err != nil {
+		log.Printf("Previews of style %s failed: %v", style.ID, err)
+		return
+	}
+
+	var urls []string
+	current := make(map[string]bool)
+	for _, face := range p.faces {
+		name := previewName(styleHash, face)
+		path := filepath.Join(previewDir, style.ID, name)
+		if _, err := os.Stat(path); err != nil {
+			if err := ms.renderPreview(face.path, style, path, p.width); err != nil {
+				log.Printf("Preview of style %s on %s failed: %v", style.ID, face.path, err)
+				continue
+			}
+		}
+		current[name] = true
+		urls = append(urls, "/uploads/previews/"+style.ID+"/"+name)
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.ready[styleID] = previewSet{urls: urls}
+	p.mu.Unlock()
+	removeStalePreviews(styleID, current)
+}
+
+// faceNameCleaner makes reference face file names safe for preview names
+var faceNameCleaner = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+func faceName(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return faceNameCleaner.ReplaceAllString(strings.ToLower(base), "-")
+}
+
+// previewName names the preview of a style definition on a face. Previews
+// are served as immutable, so the name changes whenever either does.
+func previewName(styleHash string, face referenceFace) string {
+	sum := sha256.Sum256([]byte(styleHash + face.hash))
+	return fmt.Sprintf("%s-%s.jpg", face.name, hex.EncodeToString(sum[:8]))
+}
+
+// removeStalePreviews deletes the files in a style's preview directory
+// that are not in keep; a nil keep removes the directory. Each style has
+// its own directory, so other styles' files are never touched.
+func removeStalePreviews(styleID string, keep map[string]bool) {
+	dir := filepath.Join(previewDir, styleID)
+	if keep == nil {
+		os.RemoveAll(dir)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] {
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// renderPreview applies a style to the largest face of a reference photo
+// and writes it as a JPEG scaled to width
+func (ms *MakeupService) renderPreview(facePath string, style models.MakeupStyle, outPath string, width int) error {
+	img := gocv.IMRead(facePath, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to load image: %s", facePath)
+	}
+	defer img.Close()
+
+	faces, err := ms.detectFaces(img)
+	if err != nil {
+		return err
+	}
+	selected, err := selectFaces(faces, FaceSelection{Mode: FaceSelectLargest})
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no face detected")
+	}
+	for _, m := range ms.measureFaces(img, faces, selected) {
+		if err := ms.applyMakeupToFace(&img, m, style); err != nil {
+			return err
+		}
+	}
+
+	if img.Cols() > width {
+		height := img.Rows() * width / img.Cols()
+		gocv.Resize(img, &img, image.Pt(width, height), 0, 0, gocv.InterpolationArea)
+	}
+
+	data, err := encodeMat(img, FormatJPEG, 90)
+	if err != nil {
+		return err
+	}
+
+	// Write under a temporary name so a half-written file is never served
+	// or mistaken for a finished preview
+	tempPath := outPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write preview: %v", err)
+	}
+	return os.Rename(tempPath, outPath)
+}
+
+// withPreviews fills in the style's preview URLs, if any have been
+// rendered. Until a changed style is re-rendered its previous previews are
+// shown.
+func (ms *MakeupService) withPreviews(style models.MakeupStyle) models.MakeupStyle {
+	p := ms.previews
+	if p == nil {
+		return style
+	}
+
+	p.mu.Lock()
+	set, ok := p.ready[style.ID]
+	p.mu.Unlock()
+	if ok && len(set.urls) > 0 {
+		style.PreviewURL = set.urls[0]
+		style.PreviewURLs = append([]string(nil), set.urls...)
+	}
+	return style
+}
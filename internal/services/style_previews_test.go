@@ -0,0 +1,185 @@
+package services
+
+import (
+	"image"
+	"makeup-api/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewName(t *testing.T) {
+	face := referenceFace{name: faceName("faces/Face 01.v2.PNG"), hash: "photo"}
+	name := previewName("style", face)
+	if !strings.HasPrefix(name, "face-01-v2-") || !strings.HasSuffix(name, ".jpg") {
+		t.Errorf("got %q, want face-01-v2-<hash>.jpg", name)
+	}
+
+	// The name changes with the style definition and with the photo
+	replaced := face
+	replaced.hash = "other photo"
+	for _, other := range []string{previewName("edited style", face), previewName("style", replaced)} {
+		if other == name {
+			t.Errorf("%q is reused for a different preview", name)
+		}
+	}
+	if again := previewName("style", face); again != name {
+		t.Errorf("got %q then %q for the same preview", name, again)
+	}
+}
+
+func TestPreviewStatusWithoutFaces(t *testing.T) {
+	ms := newTestMakeupService(t, &FakeFaceDetector{}, QualityConfig{})
+	if status := ms.PreviewStatus(); status.Enabled || status.Reason == "" {
+		t.Errorf("status before start = %+v, want disabled with a reason", status)
+	}
+
+	dir := t.TempDir()
+	if err := ms.StartPreviews(PreviewConfig{FacesDir: dir}); err == nil {
+		t.Fatal("started previews without reference faces")
+	}
+	status := ms.PreviewStatus()
+	if status.Enabled || !strings.Contains(status.Reason, "no reference face images") {
+		t.Errorf("status = %+v, want disabled for lack of faces", status)
+	}
+	if style, _ := ms.GetStyle(testStyle.ID); style.PreviewURL != "" {
+		t.Errorf("style has preview %s with previews disabled", style.PreviewURL)
+	}
+}
+
+func TestBundledReferenceFaces(t *testing.T) {
+	faces, err := referenceFaces(filepath.Join("..", "..", "assets", "reference-faces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, face := range faces {
+		if face.hash == "" || !strings.HasPrefix(face.name, "synthetic-") {
+			t.Errorf("reference face %+v", face)
+		}
+	}
+}
+
+func TestRemoveStalePreviews(t *testing.T) {
+	chdirTemp(t)
+
+	files := []string{
+		"x/face-aaaa.jpg",
+		"x/face-bbbb.jpg",
+		"x/face-bbbb.jpg.tmp",
+		"x-v2-foo/face-aaaa.jpg",
+	}
+	for _, name := range files {
+		path := filepath.Join(previewDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(previewDir, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	removeStalePreviews("x", map[string]bool{"face-bbbb.jpg": true})
+	want := map[string]bool{
+		"x/face-aaaa.jpg":        false,
+		"x/face-bbbb.jpg":        true,
+		"x/face-bbbb.jpg.tmp":    false,
+		"x-v2-foo/face-aaaa.jpg": true,
+	}
+	for name, kept := range want {
+		if got := exists(name); got != kept {
+			t.Errorf("%s exists = %v, want %v", name, got, kept)
+		}
+	}
+
+	// A deleted style loses its whole directory
+	removeStalePreviews("x", nil)
+	if exists("x") {
+		t.Error("previews of deleted style x remain")
+	}
+	if !exists("x-v2-foo/face-aaaa.jpg") {
+		t.Error("deleting style x removed previews of style x-v2-foo")
+	}
+}
+
+// waitForPreviews polls until the style's previews differ from previous
+func waitForPreviews(t *testing.T, ms *MakeupService, styleID string, previous []string) models.MakeupStyle {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		style, _ := ms.GetStyle(styleID)
+		if len(style.PreviewURLs) > 0 && (len(previous) == 0 || style.PreviewURLs[0] != previous[0]) {
+			return style
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("previews of style %s were not rendered", styleID)
+	return models.MakeupStyle{}
+}
+
+func previewFile(url string) string {
+	return filepath.FromSlash(strings.TrimPrefix(url, "/"))
+}
+
+func TestPreviewsRenderAndFollowStyleChanges(t *testing.T) {
+	chdirTemp(t)
+	photo := writeTestPhoto(t, 400, 300)
+
+	ms := newTestMakeupService(t, &FakeFaceDetector{Faces: []image.Rectangle{image.Rect(100, 50, 260, 250)}}, QualityConfig{})
+	if err := ms.StartPreviews(PreviewConfig{FacesDir: filepath.Dir(photo), Width: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if status := ms.PreviewStatus(); !status.Enabled || status.Faces != 1 {
+		t.Errorf("status = %+v, want enabled with one face", status)
+	}
+
+	style := waitForPreviews(t, ms, testStyle.ID, nil)
+	if len(style.PreviewURLs) != 1 || style.PreviewURL != style.PreviewURLs[0] {
+		t.Fatalf("preview URLs = %q / %v, want one", style.PreviewURL, style.PreviewURLs)
+	}
+	first := style.PreviewURLs
+	if !strings.HasPrefix(first[0], "/uploads/previews/"+testStyle.ID+"/photo-") {
+		t.Errorf("preview URL = %s", first[0])
+	}
+	preview := readTestImage(t, previewFile(first[0]))
+	if preview.Bounds().Dx() != 200 {
+		t.Errorf("preview is %d pixels wide, want 200", preview.Bounds().Dx())
+	}
+
+	// Deleting the style and creating a different one under the same ID
+	// restarts at version 1, but must not reuse the old preview
+	if err := ms.DeleteStyle(testStyle.ID, style.Version); err != nil {
+		t.Fatal(err)
+	}
+	recreated := testStyle
+	recreated.Layers = []models.EffectLayer{
+		{Type: models.LayerTint, Region: models.RegionLips, Color: "#FF0000", Opacity: 1},
+	}
+	created, err := ms.CreateStyle(recreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Version != 1 {
+		t.Fatalf("re-created style at version %d, want 1", created.Version)
+	}
+
+	style = waitForPreviews(t, ms, testStyle.ID, first)
+	if _, err := os.Stat(previewFile(style.PreviewURL)); err != nil {
+		t.Errorf("new preview missing: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(previewFile(first[0])); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("preview of the deleted style remains")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"log"
 	"makeup-api/internal/handlers"
 	"makeup-api/internal/middleware"
+	"makeup-api/internal/repository"
 	"makeup-api/internal/services"
 	"os"
+	"strconv"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -18,12 +20,138 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Open the embedded database
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "data/makeup.db"
+	}
+	db, err := repository.OpenDB(dbPath)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	resultRepo, err := repository.NewBoltResultRepository(db)
+	if err != nil {
+		log.Fatal("Failed to initialize result store:", err)
+	}
+
+	imageRepo, err := repository.NewBoltImageRepository(db)
+	if err != nil {
+		log.Fatal("Failed to initialize image registry:", err)
+	}
+
+	// Detector models are loaded once and pooled: one instance per worker
+	// plus headroom for the synchronous face detection endpoint
+	workerCount := getEnvInt("WORKER_COUNT", 2)
+	detectorPoolSize := getEnvInt("DETECTOR_POOL_SIZE", workerCount+2)
+
+	// Landmarks come from a local ONNX model when configured, otherwise the
+	// average face shape is fitted to each detected face
+	var landmarkDetector services.LandmarkDetector = services.NewMeanShapeLandmarkDetector()
+	if modelPath := os.Getenv("LANDMARK_MODEL_PATH"); modelPath != "" {
+		dnnDetector, err := services.NewDNNLandmarkDetector(modelPath, getEnvInt("LANDMARK_INPUT_SIZE", 112), detectorPoolSize)
+		if err != nil {
+			log.Fatal("Failed to load landmark model:", err)
+		}
+		landmarkDetector = dnnDetector
+	} else {
+		log.Println("WARNING: LANDMARK_MODEL_PATH is not set. Makeup is placed on an average face shape " +
+			"fitted to the face box, so lips, eyes and cheeks are approximate on tilted, turned or " +
+			"off-centre faces. Results are marked landmarks_estimated; configure a landmark model for production.")
+	}
+
+	faceDetector, err := services.NewFaceDetector(services.FaceDetectorConfig{
+		Backend:       os.Getenv("FACE_DETECTOR"),
+		CascadePath:   os.Getenv("OPENCV_CASCADE_PATH"),
+		ModelPath:     os.Getenv("FACE_MODEL_PATH"),
+		ConfigPath:    os.Getenv("FACE_MODEL_CONFIG"),
+		MinConfidence: getEnvFloat("FACE_MIN_CONFIDENCE", 0.5),
+		PoolSize:      detectorPoolSize,
+	})
+	if err != nil {
+		log.Fatal("Failed to set up face detector:", err)
+	}
+
+	// Style definitions are validated at startup so a bad file fails fast.
+	// They seed the style store: changed files update their styles, but
+	// styles edited through the API stay as edited and deleted ones are not
+	// brought back.
+	stylesDir := os.Getenv("STYLES_DIR")
+	if stylesDir == "" {
+		stylesDir = "styles"
+	}
+	styles, err := services.LoadStyles(stylesDir)
+	if err != nil {
+		log.Fatal("Failed to load styles:", err)
+	}
+	styleRepo, err := repository.NewBoltStyleRepository(db)
+	if err != nil {
+		log.Fatal("Failed to initialize style store:", err)
+	}
+	seeded, err := styleRepo.Seed(styles)
+	if err != nil {
+		log.Fatal("Failed to seed styles:", err)
+	}
+	if len(seeded.Added) > 0 || len(seeded.Updated) > 0 {
+		log.Printf("Styles added from %s: %v, updated: %v", stylesDir, seeded.Added, seeded.Updated)
+	}
+	if len(seeded.Diverged) > 0 {
+		log.Printf("WARNING: Styles %v were edited or created through the management API and differ from "+
+			"their files in %s. The files are ignored; apply the change through the API instead.", seeded.Diverged, stylesDir)
+	}
+
 	// Initialize services
-	makeupService := services.NewMakeupService()
-	imageService := services.NewImageService()
+	makeupService, err := services.NewMakeupService(faceDetector, landmarkDetector, services.QualityConfig{
+		MinSharpness:  getEnvFloat("QUALITY_MIN_SHARPNESS", 60),
+		MinFaceRatio:  getEnvFloat("QUALITY_MIN_FACE_RATIO", 0.02),
+		Enforce:       getEnvBool("QUALITY_ENFORCE", false),
+		CheckOnUpload: getEnvBool("QUALITY_CHECK_ON_UPLOAD", false),
+	}, styleRepo)
+	if err != nil {
+		log.Fatal("Failed to initialize makeup service:", err)
+	}
+
+	// Style previews are rendered in the background onto the reference
+	// faces; without any the API runs with previews disabled, which /health
+	// reports
+	facesDir := os.Getenv("REFERENCE_FACES_DIR")
+	if facesDir == "" {
+		facesDir = "assets/reference-faces"
+	}
+	if err := makeupService.StartPreviews(services.PreviewConfig{
+		FacesDir: facesDir,
+		Width:    getEnvInt("PREVIEW_WIDTH", 400),
+	}); err != nil {
+		log.Printf("WARNING: Style previews are disabled: %v. Styles are listed without preview_url; "+
+			"add licensed reference portraits to %s (see assets/reference-faces/README.md) and restart.", err, facesDir)
+	}
+	resampleFilter, err := services.ParseResampleFilter(os.Getenv("RESAMPLE_FILTER"))
+	if err != nil {
+		log.Fatal("Invalid RESAMPLE_FILTER:", err)
+	}
+	imageService := services.NewImageService(services.ImageConfig{
+		MaxFileSize:    int64(getEnvInt("MAX_FILE_SIZE", 10*1024*1024)),
+		MaxImageWidth:  getEnvInt("MAX_IMAGE_WIDTH", 1920),
+		MaxImageHeight: getEnvInt("MAX_IMAGE_HEIGHT", 1080),
+		MaxPixelWidth:  getEnvInt("MAX_UPLOAD_WIDTH", 8000),
+		MaxPixelHeight: getEnvInt("MAX_UPLOAD_HEIGHT", 8000),
+		MaxMegapixels:  getEnvFloat("MAX_UPLOAD_MEGAPIXELS", 40),
+
+		PreserveICCProfile: getEnvBool("PRESERVE_ICC_PROFILE", false),
+		ResampleFilter:     resampleFilter,
+	}, imageRepo)
+	jobQueue := services.NewJobQueue(
+		makeupService,
+		imageService,
+		resultRepo,
+		workerCount,
+		getEnvInt("JOB_QUEUE_SIZE", 100),
+	)
 
 	// Initialize handlers
-	makeupHandler := handlers.NewMakeupHandler(makeupService, imageService)
+	makeupHandler := handlers.NewMakeupHandler(makeupService, imageService, jobQueue, resultRepo)
+	fileHandler := handlers.NewFileHandler(imageService)
 
 	// Setup Gin router
 	r := gin.Default()
@@ -39,12 +167,21 @@ func main() {
 	r.Use(middleware.Logger())
 	r.Use(middleware.Recovery())
 
+	// Stored originals and results
+	r.GET("/uploads/*filepath", fileHandler.ServeUpload)
+	r.HEAD("/uploads/*filepath", fileHandler.ServeUpload)
+
 	// Routes
 	api := r.Group("/api/v1")
 	{
 		// Health check
 		api.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{"status": "ok", "message": "Makeup API is running"})
+			c.JSON(200, gin.H{
+				"status":    "ok",
+				"message":   "Makeup API is running",
+				"detectors": makeupService.DetectorStatus(),
+				"previews":  makeupService.PreviewStatus(),
+			})
 		})
 
 		// Makeup endpoints
@@ -52,8 +189,19 @@ func main() {
 		{
 			makeup.POST("/upload", makeupHandler.UploadImage)
 			makeup.POST("/apply/:style", makeupHandler.ApplyMakeupStyle)
+			makeup.GET("/images/:id/faces", makeupHandler.GetImageFaces)
 			makeup.GET("/styles", makeupHandler.GetAvailableStyles)
+			makeup.GET("/styles/:style", makeupHandler.GetStyleDetails)
 			makeup.GET("/result/:id", makeupHandler.GetResult)
+			makeup.GET("/status/:id", makeupHandler.GetProcessingStatus)
+		}
+
+		// Style management, for holders of ADMIN_TOKEN only
+		styleAdmin := api.Group("/makeup/styles", middleware.AdminAuth(os.Getenv("ADMIN_TOKEN")))
+		{
+			styleAdmin.POST("", makeupHandler.CreateStyle)
+			styleAdmin.PUT("/:style", makeupHandler.UpdateStyle)
+			styleAdmin.DELETE("/:style", makeupHandler.DeleteStyle)
 		}
 	}
 
@@ -69,3 +217,29 @@ func main() {
 	}
 }
 
+// getEnvInt reads an integer environment variable, falling back to def
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvFloat reads a float environment variable, falling back to def
+func getEnvFloat(key string, def float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvBool reads a boolean environment variable, falling back to def
+func getEnvBool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}